@@ -0,0 +1,71 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+
+	"golang.org/x/tools/imports"
+)
+
+// FixImports adds missing and removes unused imports of the source, goimports-style, and returns the fixed source
+// together with the number of lines added in front of the code.
+// Only the import declarations are replaced, all other lines stay as they are, so compiler errors keep their positions.
+// Sources that can't be parsed are returned as they are, so the compiler reports the problem.
+func FixImports(scriptPath string, src []byte) ([]byte, int) {
+	processed, err := imports.Process(scriptPath, src, nil)
+	if err != nil {
+		return src, 0
+	}
+	start, end, ok := importRange(src)
+	processedStart, processedEnd, processedOk := importRange(processed)
+	if !ok || !processedOk {
+		return src, 0
+	}
+
+	importDecls := processed[processedStart:processedEnd]
+	if start == end && len(importDecls) > 0 {
+		// No imports yet, add them below the package clause
+		importDecls = append([]byte("\n\n"), importDecls...)
+	}
+	fixed := append(append(append([]byte{}, src[:start]...), importDecls...), src[end:]...)
+	return fixed, bytes.Count(importDecls, []byte("\n")) - bytes.Count(src[start:end], []byte("\n"))
+}
+
+// importRange returns the byte range of the import declarations in src.
+// Without imports the range is empty and starts at the end of the package clause.
+func importRange(src []byte) (int, int, bool) {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", src, parser.ImportsOnly)
+	if err != nil {
+		return 0, 0, false
+	}
+	// Parsing stops after the imports, so all declarations are import declarations
+	start, end := file.Name.End(), file.Name.End()
+	if len(file.Decls) > 0 {
+		start, end = file.Decls[0].Pos(), file.Decls[len(file.Decls)-1].End()
+	}
+	return fileSet.Position(start).Offset, fileSet.Position(end).Offset, true
+}
+
+// WriteOverlay writes an overlay file for "go build -overlay", which replaces the content of the files with others, and returns its path
+func WriteOverlay(binaryDir string, replace map[string]string) string {
+	data, err := json.Marshal(map[string]map[string]string{"Replace": replace})
+	if err != nil {
+		panic(err)
+	}
+	overlayPath := filepath.Join(binaryDir, "_goplay_overlay.json")
+	if err := ioutil.WriteFile(overlayPath, data, 0600); err != nil {
+		panic(err)
+	}
+	return overlayPath
+}
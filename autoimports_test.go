@@ -0,0 +1,43 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestFixImports(t *testing.T) {
+	src := "package main\n\nimport \"os\"\n\nfunc main() {\n\tfmt.Println(strings.ToUpper(\"hello\"))\n}\n"
+	fixed, offset := FixImports("script.go", []byte(src))
+	expected(t, "FixImports", string(fixed), "package main\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\nfunc main() {\n\tfmt.Println(strings.ToUpper(\"hello\"))\n}\n")
+	expected(t, "FixImports", offset, 3)
+
+	// Blank lines in the code are kept, so lines behind the imports only move by the offset
+	src = "package main\n\nfunc main() {\n\tfmt.Println(1)\n\n\n\tundefined()\n}\n"
+	fixed, offset = FixImports("script.go", []byte(src))
+	expected(t, "FixImports", string(fixed), "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n\n\n\tundefined()\n}\n")
+	expected(t, "FixImports", strings.Split(string(fixed), "\n")[6+offset], "\tundefined()")
+
+	// Let the compiler report syntax errors
+	fixed, offset = FixImports("script.go", []byte("package main\nfunc main() {"))
+	expected(t, "FixImports", string(fixed), "package main\nfunc main() {")
+	expected(t, "FixImports", offset, 0)
+}
+
+func TestWriteOverlay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data, _ := ioutil.ReadFile(WriteOverlay(dir, map[string]string{"/src/script.go": "/tmp/copy.go"}))
+	expected(t, "WriteOverlay", string(data), `{"Replace":{"/src/script.go":"/tmp/copy.go"}}`)
+}
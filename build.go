@@ -0,0 +1,308 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// BuildOptions are additional settings for compiling a script
+type BuildOptions struct {
+	GOOS     string   // Target operating system, empty for $GOOS
+	GOARCH   string   // Target architecture, empty for $GOARCH
+	LdFlags  string   // Flags passed to the linker
+	GcFlags  string   // Flags passed to the compiler
+	Tags     string   // Comma separated list of build tags
+	Race     bool     // Enable the race detector
+	Debug    bool     // Disable optimizations and inlining, for debuggers
+	TrimPath bool     // Remove file system paths from the binary
+	Static   bool     // Disable cgo to get a static binary
+	Flags    []string // Additional "go build" flags, from the BuildFlags configuration and //goplay:build directives
+	Includes []string // Additional source files compiled together with the script, from //goplay:include directives and -include
+	Package  string   // Package to build with "go build" instead of the scripts directory, from the //goplay:package directive
+	Offline  string   // Offline mode of the go command, "vendor" or "proxy-off", empty when online
+
+	Toolchain string // Requested Go toolchain version or go binary, from the GoToolchain configuration or the //goplay:go directive
+	GoCommand string // The go binary of the requested toolchain, empty for the go command on the PATH
+	GoVersion string // Version the requested toolchain reports, as "go1.22.3 linux/amd64"
+
+	Sources  SourceMap         // Original sources of generated files, for mapping compiler errors back to them
+	Verified map[string][]byte // Verified contents of signed files with RequireSignature, which are compiled instead of the files
+}
+
+// OS returns the target operating system
+func (o BuildOptions) OS() string {
+	if o.GOOS != "" {
+		return o.GOOS
+	}
+	if goos := os.Getenv("GOOS"); goos != "" {
+		return goos
+	}
+	return runtime.GOOS
+}
+
+// Arch returns the target architecture
+func (o BuildOptions) Arch() string {
+	if o.GOARCH != "" {
+		return o.GOARCH
+	}
+	if goarch := os.Getenv("GOARCH"); goarch != "" {
+		return goarch
+	}
+	return runtime.GOARCH
+}
+
+// Env returns the environment for build commands
+func (o BuildOptions) Env() []string {
+	env := os.Environ()
+	if o.GOOS != "" {
+		env = append(env, "GOOS="+o.GOOS)
+	}
+	if o.GOARCH != "" {
+		env = append(env, "GOARCH="+o.GOARCH)
+	}
+	if o.Static {
+		env = append(env, "CGO_ENABLED=0")
+	}
+	if o.Toolchain != "" && o.GoCommand == "" {
+		env = append(env, "GOTOOLCHAIN="+GoToolchainEnv(o.Toolchain))
+	}
+	switch o.Offline {
+	case "vendor":
+		env = append(env, "GOFLAGS="+strings.TrimSpace(os.Getenv("GOFLAGS")+" -mod=vendor"), "GOPROXY=off")
+	case "proxy-off":
+		env = append(env, "GOPROXY=off")
+	}
+	return env
+}
+
+// GoBuildArgs returns the additional arguments for "go build"
+func (o BuildOptions) GoBuildArgs() (args []string) {
+	if o.LdFlags != "" {
+		args = append(args, "-ldflags", o.LdFlags)
+	}
+	if o.Debug {
+		args = append(args, "-gcflags", "all=-N -l")
+	}
+	if o.GcFlags != "" {
+		args = append(args, "-gcflags", o.DebugGcFlags())
+	}
+	if o.Tags != "" {
+		args = append(args, "-tags", o.Tags)
+	}
+	if o.Race {
+		args = append(args, "-race")
+	}
+	if o.TrimPath {
+		args = append(args, "-trimpath")
+	}
+	return append(args, o.Flags...)
+}
+
+// DebugGcFlags returns the -gcflags of the options. The last matching -gcflags wins for a package,
+// so in debug mode the packages of the users flags still get "-N -l", behind the optional package pattern.
+func (o BuildOptions) DebugGcFlags() string {
+	if !o.Debug {
+		return o.GcFlags
+	}
+	if index := strings.Index(o.GcFlags, "="); index > 0 && !strings.HasPrefix(o.GcFlags, "-") {
+		return o.GcFlags[:index+1] + strings.TrimSpace("-N -l "+o.GcFlags[index+1:])
+	}
+	return "-N -l " + o.GcFlags
+}
+
+// Go returns the go command to build with
+func (o BuildOptions) Go() string {
+	if o.GoCommand != "" {
+		return o.GoCommand
+	}
+	return "go"
+}
+
+// CacheKey returns a short hash of all options that change the resulting binary, or "" for the default options.
+// It keeps binaries built with different options from overwriting each other in the goplay directory.
+func (o BuildOptions) CacheKey() string {
+	args := o.GoBuildArgs()
+	if o.Static {
+		args = append(args, "CGO_ENABLED=0")
+	}
+	for _, include := range o.Includes {
+		args = append(args, "include="+include)
+	}
+	if o.Toolchain != "" {
+		args = append(args, "toolchain="+o.Toolchain, "go="+o.GoCommand, "version="+o.GoVersion)
+	}
+	if len(args) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(strings.Join(args, "\x00"))))[:12]
+}
+
+// ScriptBuildOptions returns the build options for running a script, combining the commandline flags and the script settings.
+// Snippets come with the sources of their generated files, they are trusted and don't need to be signed.
+func ScriptBuildOptions(scriptPath string, sources SourceMap) BuildOptions {
+	options := BuildOptions{
+		LdFlags: *ldFlagsFlag,
+		GcFlags: *gcFlagsFlag,
+		Tags:    *tagsFlag,
+		Race:    *raceFlag,
+		Debug:   *debugFlag,
+		Sources: sources,
+	}
+	options.ReadScript(scriptPath)
+	return options
+}
+
+// ReadScript sets the options coming from the configuration and the script itself: build flags, included files, package and offline mode.
+// With RequireSignature, the script and its included files are verified first, and everything is read from their verified contents.
+func (o *BuildOptions) ReadScript(scriptPath string) {
+	if o.Sources == nil {
+		o.Verified = RequireSignatures(scriptPath)
+	}
+	o.Includes = o.ScriptIncludes(scriptPath)
+	if o.Verified != nil {
+		for filename, content := range RequireSignatures(o.Includes...) {
+			o.Verified[filename] = content
+		}
+	}
+	o.Flags = o.ScriptBuildFlags(scriptPath)
+	o.Package = o.ScriptPackage(scriptPath)
+	// Included files belong to the scripts package, another package can't be built with them
+	if o.Package != "" && len(o.Includes) > 0 {
+		log.Fatalf("Could not build [%s]: %spackage builds another package, which can't include [%s]", scriptPath, DIRECTIVE, strings.Join(o.Includes, " "))
+	}
+	// Other files of the package are not signed, so only the script and its includes can be built
+	if o.Verified != nil && (config.CompleteBuild || o.Package != "") {
+		log.Fatalf("Refusing to run: RequireSignature does not allow complete builds or %spackage, the other files of [%s] are not signed", DIRECTIVE, scriptPath)
+	}
+	o.Offline = OfflineMode(scriptPath)
+	o.Toolchain = o.ScriptToolchain(scriptPath)
+	// The build runs outside of the sandbox, neither it nor the toolchain version may run anything chosen by the script
+	if *sandboxFlag {
+		if err := CheckSandboxBuild(scriptPath, *o); err != nil {
+			log.Fatalf("Refusing to build for the sandbox: %s", err)
+		}
+	}
+	o.GoCommand = FindToolchain(o.Toolchain)
+	if o.Toolchain != "" {
+		// The same version or go binary may stand for another release later on
+		o.GoVersion = ToolchainVersion(*o)
+		Verbosef("toolchain [%s], go command [%s], version [%s]", o.Toolchain, o.Go(), o.GoVersion)
+	}
+}
+
+// Directives returns the values of the scripts //goplay:name directives, from its verified content with RequireSignature
+func (o BuildOptions) Directives(scriptPath string, name string) []string {
+	if src, found := o.Verified[scriptPath]; found {
+		return ParseDirectives(src, name)
+	}
+	return ReadDirectives(scriptPath, name)
+}
+
+// ScriptBuildFlags returns the flags of the BuildFlags configuration, followed by those of the scripts //goplay:build directives.
+// Both are split like shell words, quotes keep flags like -ldflags "-s -w" together.
+func (o BuildOptions) ScriptBuildFlags(scriptPath string) []string {
+	flags, err := SplitWords(config.BuildFlags)
+	if err != nil {
+		log.Fatalf("Could not parse BuildFlags: %s", err)
+	}
+	for _, directive := range o.Directives(scriptPath, "build") {
+		words, err := SplitWords(directive)
+		if err != nil {
+			log.Fatalf("Could not parse %sbuild directive of [%s]: %s", DIRECTIVE, scriptPath, err)
+		}
+		flags = append(flags, words...)
+	}
+	return flags
+}
+
+// BuildCommand implements "goplay build", which compiles a script into a standalone binary without running it
+func BuildCommand(args []string) {
+	var options BuildOptions
+	flags := NewBuildFlagSet("build", &options)
+	output := flags.String("o", "", "output binary")
+
+	files := ParseInterspersed(flags, args)
+	if len(files) != 1 {
+		usage()
+	}
+	scriptPath := ReadBuildConfiguration(files[0])
+	options.ReadScript(scriptPath)
+
+	binaryPath := *output
+	if binaryPath == "" {
+		binaryPath = BinaryName(filepath.Base(scriptPath), options.OS())
+	}
+	binaryPath, err := filepath.Abs(binaryPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if binaryPath == scriptPath {
+		log.Fatalf("Binary [%s] would overwrite the script, use -o to choose another name", binaryPath)
+	}
+	Verbosef("binary path [%s]", binaryPath)
+
+	CompileBinary(scriptPath, binaryPath, config.CompleteBuild, options)
+}
+
+// NewBuildFlagSet returns a FlagSet with all the options shared by the build-only subcommands
+func NewBuildFlagSet(name string, options *BuildOptions) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = printUsage
+	flags.BoolVar(completeBuildFlag, "b", *completeBuildFlag, "complete build")
+	flags.StringVar(&options.GOOS, "os", "", "target operating system")
+	flags.StringVar(&options.GOARCH, "arch", "", "target architecture")
+	flags.StringVar(&options.LdFlags, "ldflags", *ldFlagsFlag, "linker flags")
+	flags.StringVar(&options.GcFlags, "gcflags", *gcFlagsFlag, "compiler flags")
+	flags.StringVar(&options.Tags, "tags", *tagsFlag, "build tags")
+	flags.BoolVar(&options.Race, "race", *raceFlag, "race detector")
+	flags.BoolVar(&options.TrimPath, "trimpath", false, "remove file system paths")
+	flags.BoolVar(&options.Static, "static", false, "static binary")
+	return flags
+}
+
+// ParseInterspersed parses the flags and returns all non-flag arguments, allowing flags before and after them
+func ParseInterspersed(flags *flag.FlagSet, args []string) (positional []string) {
+	for {
+		ParseFlags(flags, args)
+		if flags.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// ReadBuildConfiguration returns the absolute script path and reads its configuration files
+func ReadBuildConfiguration(script string) string {
+	scriptPath, err := filepath.Abs(script)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ReadConfiguration(filepath.Dir(scriptPath))
+	if *completeBuildFlag {
+		config.CompleteBuild = true
+	}
+	return scriptPath
+}
+
+// BinaryName returns the name of the binary for scriptName, with ".exe" appended for windows.
+// Only the ".go" extension is removed, so "my.tool.go" becomes "my.tool".
+func BinaryName(scriptName string, goos string) string {
+	name := strings.TrimSuffix(scriptName, ".go")
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
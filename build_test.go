@@ -0,0 +1,126 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"debug/elf"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildOptions(t *testing.T) {
+	options := BuildOptions{GOOS: "windows", GOARCH: "386", LdFlags: "-s -w", TrimPath: true, Static: true}
+
+	expected(t, "OS", options.OS(), "windows")
+	expected(t, "Arch", options.Arch(), "386")
+	expected(t, "GoBuildArgs", strings.Join(options.GoBuildArgs(), " "), "-ldflags -s -w -trimpath")
+
+	env := strings.Join(options.Env(), "\n")
+	for _, variable := range []string{"GOOS=windows", "GOARCH=386", "CGO_ENABLED=0"} {
+		if !strings.Contains(env, variable) {
+			t.Errorf("Build environment should contain [%s]", variable)
+		}
+	}
+
+	if len(BuildOptions{}.GoBuildArgs()) != 0 {
+		t.Error("Default build options should not add any arguments")
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	expected(t, "CacheKey", BuildOptions{}.CacheKey(), "")
+
+	race := BuildOptions{Race: true}.CacheKey()
+	if race == "" || race == (BuildOptions{Tags: "integration"}).CacheKey() {
+		t.Errorf("Different build options should have different cache keys, but got [%s]", race)
+	}
+	expected(t, "CacheKey", race, BuildOptions{Race: true}.CacheKey())
+
+	// Only the resulting binary matters, not how the target was given
+	if (BuildOptions{GOOS: "linux"}).CacheKey() != "" {
+		t.Error("Target platform should not be part of the cache key")
+	}
+
+	if (BuildOptions{Includes: []string{"/src/helpers.go"}}).CacheKey() == "" {
+		t.Error("Included files should be part of the cache key")
+	}
+	if (BuildOptions{Toolchain: "1.22"}).CacheKey() == (BuildOptions{Toolchain: "1.23"}).CacheKey() {
+		t.Error("The toolchain should be part of the cache key")
+	}
+	if (BuildOptions{Toolchain: "1.22", GoVersion: "go1.22.0 linux/amd64"}).CacheKey() == (BuildOptions{Toolchain: "1.22", GoVersion: "go1.22.9 linux/amd64"}).CacheKey() {
+		t.Error("The version of the toolchain should be part of the cache key")
+	}
+}
+
+func TestScriptBuildFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	scriptPath := filepath.Join(dir, "flags.go")
+	script := "//goplay:build -ldflags \"-s -w -X 'main.Version=1.0 beta'\"\n\npackage main\n\nfunc main() {}\n"
+	if err := ioutil.WriteFile(scriptPath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	buildFlags := config.BuildFlags
+	defer func() { config.BuildFlags = buildFlags }()
+	config.BuildFlags = `-tags "a b"`
+
+	flags := BuildOptions{}.ScriptBuildFlags(scriptPath)
+	expected(t, "ScriptBuildFlags", strings.Join(flags, "|"), "-tags|a b|-ldflags|-s -w -X 'main.Version=1.0 beta'")
+}
+
+func TestBinaryName(t *testing.T) {
+	expected(t, "BinaryName", BinaryName("script.go", "linux"), "script")
+	expected(t, "BinaryName", BinaryName("my.tool.go", "linux"), "my.tool")
+	expected(t, "BinaryName", BinaryName("deploy", "linux"), "deploy")
+	expected(t, "BinaryName", BinaryName("my.tool.go", "windows"), "my.tool.exe")
+}
+
+func TestBuildCommand(t *testing.T) {
+	binaryFilename := "TestBuildCommand_output"
+	if Exist(binaryFilename) {
+		removeFile(t, binaryFilename)
+	}
+
+	// Options are allowed after FILE
+	if out, err := exec.Command("goplay", "build", "output.go", "-o", binaryFilename, "-static").CombinedOutput(); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+	if !Exist(binaryFilename) {
+		t.Fatalf("Built binary does not exist: [%s]", binaryFilename)
+	}
+	defer removeFile(t, binaryFilename)
+
+	out, err := exec.Command("./" + binaryFilename).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, binaryFilename, string(out), "The night is all magic\n")
+}
+
+func TestBuildCommandCrossCompile(t *testing.T) {
+	binaryFilename := "TestBuildCommandCrossCompile_output"
+	if out, err := exec.Command("goplay", "build", "-os", "linux", "-arch", "arm64", "-o", binaryFilename, "output.go").CombinedOutput(); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+	defer removeFile(t, binaryFilename)
+
+	binary, err := elf.Open(binaryFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer binary.Close()
+	expected(t, binaryFilename, binary.Machine, elf.EM_AARCH64)
+}
@@ -0,0 +1,161 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CacheCommand implements "goplay cache dir FILE" and "goplay cache clean FILE"
+func CacheCommand(args []string) {
+	if len(args) != 2 {
+		usage()
+	}
+	scriptPath, err := filepath.Abs(args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	ReadConfiguration(filepath.Dir(scriptPath))
+
+	switch args[0] {
+	case "dir":
+		fmt.Println(CacheDirectory(scriptPath))
+
+	case "clean":
+		for _, binaryPath := range CachedBinaries(scriptPath) {
+			Verbosef("removing [%s]", binaryPath)
+			if *dryRunFlag {
+				continue
+			}
+			if err := os.Remove(binaryPath); err != nil {
+				log.Fatalf("Could not remove binary: %s", err)
+			}
+		}
+
+	default:
+		usage()
+	}
+}
+
+// CachedBinaries returns all compiled binaries of the script, including those built with different build flags
+func CachedBinaries(scriptPath string) (binaries []string) {
+	binaryPath := BinaryPath(scriptPath, BuildOptions{})
+	if Exist(binaryPath) {
+		binaries = append(binaries, binaryPath)
+	}
+	flagsBinaries, err := filepath.Glob(filepath.Join(filepath.Dir(binaryPath), "flags-*", filepath.Base(binaryPath)))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return append(binaries, flagsBinaries...)
+}
+
+// IsSharedGoplayDirectory returns true for absolute goplay directories, which may be shared between users
+func IsSharedGoplayDirectory() bool {
+	return filepath.IsAbs(config.GoplayDirectory)
+}
+
+// UserDirectoryName returns the name of the users own subdirectory inside shared goplay directories
+func UserDirectoryName() string {
+	if uid := os.Getuid(); uid != -1 {
+		return "user-" + strconv.Itoa(uid)
+	}
+	if current, err := user.Current(); err == nil {
+		return "user-" + strings.NewReplacer(`\`, "_", "/", "_").Replace(current.Username)
+	}
+	return "user"
+}
+
+// CacheRoot returns the topmost directory of the scripts cache, which belongs to the current user alone
+func CacheRoot(scriptPath string) string {
+	if IsSharedGoplayDirectory() {
+		return filepath.Join(config.GoplayDirectory, UserDirectoryName())
+	}
+	return filepath.Join(filepath.Dir(scriptPath), config.GoplayDirectory)
+}
+
+// PrepareCacheDirectory creates the binary directory of the script, with all new directories only accessible by the current user.
+// It fails if somebody else could plant or replace binaries in it.
+func PrepareCacheDirectory(scriptPath string, binaryDir string) error {
+	if IsSharedGoplayDirectory() {
+		if !Exist(config.GoplayDirectory) {
+			if err := os.MkdirAll(config.GoplayDirectory, 0700); err != nil {
+				return err
+			}
+		}
+		if err := CheckSharedDirectory(config.GoplayDirectory); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(binaryDir, 0700); err != nil {
+		return err
+	}
+
+	// Every directory from the cache root down to the binary directory has to be private
+	root := CacheRoot(scriptPath)
+	for dir := binaryDir; ; dir = filepath.Dir(dir) {
+		if err := CheckPrivateFile(dir); err != nil {
+			return err
+		}
+		if dir == root || dir == filepath.Dir(dir) {
+			return nil
+		}
+	}
+}
+
+// CheckSharedDirectory returns an error, if other users could rename or remove the subdirectories of the shared directory.
+// That is the case for directories writable by others without sticky bit (like /tmp has), and for directories owned by other users.
+func CheckSharedDirectory(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("[%s] is not a directory", dir)
+	}
+	if info.Mode().Perm()&0022 != 0 && info.Mode()&os.ModeSticky == 0 {
+		return fmt.Errorf("[%s] is writable by other users, but has no sticky bit", dir)
+	}
+	if owner, ok := FileOwner(info); ok && owner != os.Getuid() && owner != 0 {
+		return fmt.Errorf("[%s] is owned by another user, use a GoplayDirectory of your own", dir)
+	}
+	return nil
+}
+
+// CheckPrivateFile returns an error, if the file or directory is not owned by the current user or writable by other users
+func CheckPrivateFile(filename string) error {
+	info, err := os.Lstat(filename)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("[%s] is a symbolic link", filename)
+	}
+	owner, ok := FileOwner(info)
+	if !ok {
+		return nil // No ownership, no permission bits
+	}
+	if owner != os.Getuid() {
+		return fmt.Errorf("[%s] is owned by another user", filename)
+	}
+	// Binaries are created according to the users umask, which often lets the group write.
+	// Inside private directories that is harmless, so only directories have to be private to the group as well.
+	var mask os.FileMode = 0002
+	if info.IsDir() {
+		mask = 0022
+	}
+	if info.Mode().Perm()&mask != 0 {
+		return fmt.Errorf("[%s] is writable by other users (mode %s)", filename, info.Mode().Perm())
+	}
+	return nil
+}
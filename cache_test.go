@@ -0,0 +1,115 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCacheRoot(t *testing.T) {
+	goplayDirectory := config.GoplayDirectory
+	defer func() { config.GoplayDirectory = goplayDirectory }()
+
+	config.GoplayDirectory = ".goplay"
+	expected(t, "CacheRoot", CacheRoot("/scripts/deploy.go"), filepath.Join("/scripts", ".goplay"))
+
+	config.GoplayDirectory = "/tmp/.goplay_bin"
+	expected(t, "CacheRoot", CacheRoot("/scripts/deploy.go"), filepath.Join("/tmp/.goplay_bin", UserDirectoryName()))
+	if !strings.HasPrefix(CacheDirectory("/scripts/deploy.go"), CacheRoot("/scripts/deploy.go")) {
+		t.Error("Cache directories inside shared goplay directories should belong to the user")
+	}
+}
+
+func TestPrepareCacheDirectory(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permission bits on windows")
+	}
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	goplayDirectory := config.GoplayDirectory
+	defer func() { config.GoplayDirectory = goplayDirectory }()
+
+	config.GoplayDirectory = filepath.Join(dir, "shared")
+	scriptPath := filepath.Join(dir, "script.go")
+	binaryDir := CacheDirectory(scriptPath)
+	if err := PrepareCacheDirectory(scriptPath, binaryDir); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(CacheRoot(scriptPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "PrepareCacheDirectory", info.Mode().Perm(), os.FileMode(0700))
+	expected(t, "PrepareCacheDirectory", Exist(binaryDir), true)
+
+	// Shared directories need the sticky bit, if everybody can write to them
+	if err := os.Chmod(config.GoplayDirectory, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := PrepareCacheDirectory(scriptPath, binaryDir); err == nil {
+		t.Error("World-writable goplay directory without sticky bit should be refused")
+	}
+	if err := os.Chmod(config.GoplayDirectory, 0777|os.ModeSticky); err != nil {
+		t.Fatal(err)
+	}
+	if err := PrepareCacheDirectory(scriptPath, binaryDir); err != nil {
+		t.Error(err)
+	}
+
+	// The users own directories must not be writable by others
+	if err := os.Chmod(binaryDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := PrepareCacheDirectory(scriptPath, binaryDir); err == nil {
+		t.Error("World-writable cache directory should be refused")
+	}
+}
+
+func TestCheckPrivateFile(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permission bits on windows")
+	}
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	binaryPath := filepath.Join(dir, "binary")
+	if err := ioutil.WriteFile(binaryPath, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(binaryPath, 0775); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPrivateFile(binaryPath); err != nil {
+		t.Error(err)
+	}
+
+	if err := os.Chmod(binaryPath, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPrivateFile(binaryPath); err == nil {
+		t.Error("World-writable binary should be refused")
+	}
+
+	linkPath := filepath.Join(dir, "link")
+	if err := os.Symlink(binaryPath, linkPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckPrivateFile(linkPath); err == nil {
+		t.Error("Symbolic links should be refused")
+	}
+}
@@ -0,0 +1,19 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+)
+
+// FileOwner returns the user id of the owner of the file, which is not available on windows
+func FileOwner(info os.FileInfo) (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,83 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// All goplay subcommands, for shell completion
+var subcommands = []string{"run", "watch", "build", "dist", "cache", "config", "version", "completion", "repl", "deps", "sign"}
+
+// CompletionCommand implements "goplay completion bash|zsh|fish", which prints a shell completion script
+func CompletionCommand(args []string) {
+	if len(args) != 1 {
+		usage()
+	}
+	script, err := CompletionScript(args[0], FlagNames(flag.CommandLine))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(script)
+}
+
+// FlagNames returns the names of all flags of the FlagSet, in sorted order
+func FlagNames(flags *flag.FlagSet) (names []string) {
+	flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+	sort.Strings(names)
+	return names
+}
+
+// CompletionScript returns the completion script for the shell, completing subcommands, options, and Go files
+func CompletionScript(shell string, flagNames []string) (string, error) {
+	var options []string
+	for _, name := range flagNames {
+		if len(name) == 1 {
+			options = append(options, "-"+name)
+		} else {
+			options = append(options, "--"+name)
+		}
+	}
+
+	switch shell {
+	case "bash", "zsh":
+		script := fmt.Sprintf(`_goplay() {
+	local cur="${COMP_WORDS[COMP_CWORD]}"
+	if [[ "$cur" == -* ]]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur"))
+	elif [[ $COMP_CWORD -eq 1 ]]; then
+		COMPREPLY=($(compgen -W "%s" -- "$cur") $(compgen -f -- "$cur"))
+	else
+		COMPREPLY=($(compgen -f -- "$cur"))
+	fi
+}
+complete -o filenames -F _goplay goplay
+`, strings.Join(options, " "), strings.Join(subcommands, " "))
+		if shell == "zsh" {
+			script = "autoload -U +X bashcompinit && bashcompinit\n" + script
+		}
+		return script, nil
+
+	case "fish":
+		lines := []string{fmt.Sprintf("complete -c goplay -n __fish_use_subcommand -a '%s'", strings.Join(subcommands, " "))}
+		for _, name := range flagNames {
+			if len(name) == 1 {
+				lines = append(lines, "complete -c goplay -s "+name)
+			} else {
+				lines = append(lines, "complete -c goplay -l "+name)
+			}
+		}
+		return strings.Join(lines, "\n") + "\n", nil
+	}
+	return "", fmt.Errorf("Unknown shell [%s], must be bash, zsh or fish", shell)
+}
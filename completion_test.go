@@ -0,0 +1,41 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestCompletionScript(t *testing.T) {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.Bool("f", false, "")
+	flags.Bool("force", false, "")
+	names := FlagNames(flags)
+	expected(t, "FlagNames", strings.Join(names, " "), "f force")
+
+	bash, err := CompletionScript("bash", names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(bash, `compgen -W "-f --force"`) || !strings.Contains(bash, "complete -o filenames -F _goplay goplay") {
+		t.Errorf("Unexpected bash completion script:\n%s", bash)
+	}
+
+	fish, err := CompletionScript("fish", names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fish, "complete -c goplay -s f\ncomplete -c goplay -l force\n") {
+		t.Errorf("Unexpected fish completion script:\n%s", fish)
+	}
+
+	if _, err := CompletionScript("tcsh", names); err == nil {
+		t.Error("Shell [tcsh] should not be supported")
+	}
+}
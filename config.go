@@ -7,9 +7,11 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"log"
-	"regexp"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -23,9 +25,109 @@ type Config struct {
 	HotReloadRecursive       bool
 	HotReloadWatchExtensions FileExtensions
 	GoplayDirectory          string
+	BuildFlags               string
+	Root                     bool
+	AutoImports              bool
+	Offline                  bool
+	GoToolchain              string
+	RequireSignature         bool
+	SandboxCPU               int
+	SandboxMemory            string
+	SandboxFiles             int
 }
 
-var configRx = regexp.MustCompile(`\s*([[:alpha:]]\w*)\s+(.+)`)
+// Where each configuration value came from, by normalized key. Keys without a source still have their default value.
+var configSources = make(map[string]string)
+
+// IsLocalConfiguration returns true if the value of the key comes from a local .goplayrc file, which is part of the scripts project
+func IsLocalConfiguration(key string) bool {
+	source := configSources[NormalizeKey(key)]
+	index := strings.LastIndex(source, ":")
+	return index > 0 && filepath.Base(source[:index]) == "."+goplayRc && source[:index] != userGoplayRc
+}
+
+// ConfigError is a problem found in a configuration file
+type ConfigError struct {
+	Filename string
+	Line     int
+	Message  string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Filename, e.Line, e.Message)
+}
+
+// configSetters maps the normalized configuration keys to functions setting the corresponding Config field
+var configSetters = map[string]func(config *Config, value string) error{
+	"forcecompile": func(config *Config, value string) (err error) {
+		config.ForceCompile, err = ParseBool(value)
+		return err
+	},
+	"completebuild": func(config *Config, value string) (err error) {
+		config.CompleteBuild, err = ParseBool(value)
+		return err
+	},
+	"hotreload": func(config *Config, value string) (err error) {
+		config.HotReload, err = ParseBool(value)
+		return err
+	},
+	"hotreloadrecursive": func(config *Config, value string) (err error) {
+		config.HotReloadRecursive, err = ParseBool(value)
+		return err
+	},
+	"hotreloadwatchextensions": func(config *Config, value string) error {
+		config.HotReloadWatchExtensions = ParseList(value)
+		return nil
+	},
+	"goplaydirectory": func(config *Config, value string) error {
+		if value == "" {
+			return fmt.Errorf("GoplayDirectory must not be empty")
+		}
+		config.GoplayDirectory = value
+		return nil
+	},
+	"buildflags": func(config *Config, value string) error {
+		config.BuildFlags = value
+		return nil
+	},
+	"root": func(config *Config, value string) (err error) {
+		config.Root, err = ParseBool(value)
+		return err
+	},
+	"autoimports": func(config *Config, value string) (err error) {
+		config.AutoImports, err = ParseBool(value)
+		return err
+	},
+	"offline": func(config *Config, value string) (err error) {
+		config.Offline, err = ParseBool(value)
+		return err
+	},
+	"gotoolchain": func(config *Config, value string) error {
+		config.GoToolchain = value
+		return nil
+	},
+	"requiresignature": func(config *Config, value string) error {
+		// Once required, signatures can't be switched off again, not even by a local .goplayrc planted next to a script
+		required, err := ParseBool(value)
+		config.RequireSignature = config.RequireSignature || required
+		return err
+	},
+	"sandboxcpu": func(config *Config, value string) (err error) {
+		config.SandboxCPU, err = ParseLimit(value)
+		return err
+	},
+	"sandboxmemory": func(config *Config, value string) error {
+		if _, err := ParseSize(value); err != nil {
+			return err
+		}
+		config.SandboxMemory = value
+		return nil
+	},
+	"sandboxfiles": func(config *Config, value string) (err error) {
+		config.SandboxFiles, err = ParseLimit(value)
+		return err
+	},
+}
 
 func (extensions *FileExtensions) Contains(s string) bool {
 	for _, e := range *extensions {
@@ -36,52 +138,226 @@ func (extensions *FileExtensions) Contains(s string) bool {
 	return false
 }
 
-// Read configuration and overwrite values if found
-func ReadConfigurationFile(filename string, config *Config) bool {
-	if Exist(filename) {
-		bytes, err := ioutil.ReadFile(filename)
-		if err != nil {
-			log.Fatalf("Could not read configuration file [%s]: %s", filename, err)
+// NormalizeKey converts a configuration key to lowercase and removes all underscores, "Goplay_Directory" becomes "goplaydirectory"
+func NormalizeKey(key string) string {
+	return strings.Replace(strings.ToLower(key), "_", "", -1)
+}
+
+// ParseBool accepts everything strconv.ParseBool does, as well as yes/no and on/off, regardless of case
+func ParseBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "on":
+		return true, nil
+	case "no", "off":
+		return false, nil
+	}
+	if flag, err := strconv.ParseBool(strings.ToLower(value)); err == nil {
+		return flag, nil
+	}
+	return false, fmt.Errorf("invalid boolean [%s], must be one of true/false, yes/no, on/off, 1/0", value)
+}
+
+// ParseLimit parses a resource limit, which is a non-negative number and 0 for unlimited
+func ParseLimit(value string) (int, error) {
+	limit, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("invalid limit [%s], must be a number, 0 for unlimited", value)
+	}
+	return limit, nil
+}
+
+// ParseList splits a comma separated list, ignoring whitespace around the elements
+func ParseList(value string) (list []string) {
+	for _, element := range strings.Split(value, ",") {
+		if element = strings.TrimSpace(element); element != "" {
+			list = append(list, element)
 		}
+	}
+	return list
+}
 
-		properties := make(map[string]string)
-		if matched := configRx.FindAllStringSubmatch(string(bytes), -1); matched != nil {
-			for _, match := range matched {
-				// Convert to lowercase, and remove all underscores
-				key := strings.Replace(strings.ToLower(match[1]), "_", "", -1)
-				value := strings.ToLower(strings.Trim(match[2], "\t "))
-				properties[key] = value
-			}
+// SetConfigValue sets the configuration value for the key, which is normalized first
+func SetConfigValue(config *Config, key string, value string) error {
+	setter, found := configSetters[NormalizeKey(key)]
+	if !found {
+		return fmt.Errorf("unknown key [%s]", key)
+	}
+	return setter(config, value)
+}
+
+// ParseConfiguration parses the content of a configuration file and overwrites all values found.
+//
+// Every line contains a single "Key Value" or "Key = Value" pair, empty lines and lines starting with "#" are ignored.
+// Keys are case insensitive and may contain underscores, values keep their case and may be enclosed in double quotes.
+// Errors for unknown keys or invalid values are returned, all other values are still applied.
+// Invalid booleans are treated as false, just like in previous versions.
+// The returned map contains the line number of every key that was set.
+func ParseConfiguration(filename string, data []byte, config *Config) (lines map[string]int, errors []error) {
+	lines = make(map[string]int)
+	for number, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
 		}
 
-		if value, found := properties["forcecompile"]; found {
-			flag, _ := strconv.ParseBool(value)
-			config.ForceCompile = value == "yes" || flag
+		key, value := line, ""
+		if index := strings.IndexAny(line, " \t="); index != -1 {
+			key, value = line[:index], strings.TrimSpace(line[index:])
+			value = strings.TrimSpace(strings.TrimPrefix(value, "="))
 		}
-		if value, found := properties["completebuild"]; found {
-			flag, _ := strconv.ParseBool(value)
-			config.CompleteBuild = value == "yes" || flag
+		if len(value) >= 2 && strings.HasPrefix(value, `"`) && strings.HasSuffix(value, `"`) {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
 		}
-		if value, found := properties["hotreload"]; found {
-			flag, _ := strconv.ParseBool(value)
-			config.HotReload = value == "yes" || flag
+
+		if err := SetConfigValue(config, key, value); err != nil {
+			errors = append(errors, &ConfigError{filename, number + 1, err.Error()})
 		}
-		if value, found := properties["hotreloadrecursive"]; found {
-			flag, _ := strconv.ParseBool(value)
-			config.HotReloadRecursive = value == "yes" || flag
+		if _, found := configSetters[NormalizeKey(key)]; found {
+			lines[NormalizeKey(key)] = number + 1
 		}
-		if value, found := properties["hotreloadwatchextensions"]; found {
-			var extensions []string
-			if value != "" {
-				extensions = strings.SplitN(value, ",", -1)
+	}
+	return lines, errors
+}
+
+// LocalConfigurationFiles returns all .goplayrc files from the script directory upwards, ordered from outermost to innermost.
+// The search stops at the first directory containing a go.mod or .git, at a configuration file with "Root yes", or at the filesystem root.
+// Files that other users could have planted or changed are skipped with a warning.
+func LocalConfigurationFiles(scriptDir string) (files []string) {
+	dir := filepath.Clean(scriptDir)
+	for {
+		filename := filepath.Join(dir, "."+goplayRc)
+		if Exist(filename) && filename != userGoplayRc { // ~/.goplayrc is always read anyway
+			if err := CheckConfigurationFile(filename); err != nil {
+				messageLog.Printf("warning: skipping configuration file: %s", err)
+			} else {
+				files = append([]string{filename}, files...)
+
+				bytes, err := ioutil.ReadFile(filename)
+				if err != nil {
+					log.Fatalf("Could not read configuration file [%s]: %s", filename, err)
+				}
+				var local Config
+				if ParseConfiguration(filename, bytes, &local); local.Root {
+					return files
+				}
 			}
-			config.HotReloadWatchExtensions = extensions
 		}
-		if value, found := properties["goplaydirectory"]; found {
-			config.GoplayDirectory = value
+
+		if Exist(filepath.Join(dir, "go.mod")) || Exist(filepath.Join(dir, ".git")) {
+			return files
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return files
 		}
+		dir = parent
+	}
+}
+
+// CheckConfigurationFile returns an error, if another user could have planted or changed the local configuration file.
+// It has to be owned by the current user or root, and neither the file nor its directory may be writable by others, like /tmp is.
+func CheckConfigurationFile(filename string) error {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return err
+	}
+	owner, ok := FileOwner(info)
+	if !ok {
+		return nil // No ownership, no permission bits
+	}
+	if owner != os.Getuid() && owner != 0 {
+		return fmt.Errorf("[%s] is owned by another user", filename)
+	}
+	if info.Mode().Perm()&0002 != 0 {
+		return fmt.Errorf("[%s] is writable by other users (mode %s)", filename, info.Mode().Perm())
+	}
+	dirInfo, err := os.Stat(filepath.Dir(filename))
+	if err != nil {
+		return err
+	}
+	if dirInfo.Mode().Perm()&0002 != 0 {
+		return fmt.Errorf("[%s] is inside a directory writable by other users", filename)
+	}
+	return nil
+}
+
+// Prefix of environment variables overriding configuration values, like GOPLAY_FORCECOMPILE=1
+const ENV_PREFIX = "GOPLAY_"
+
+// ParseEnvironment overwrites the configuration with all GOPLAY_<KEY>=value variables found in environ.
+// Keys are normalized just like in configuration files, so GOPLAY_GOPLAY_DIRECTORY works as well as GOPLAY_GOPLAYDIRECTORY.
+// The returned map contains the variable name of every key that was set.
+func ParseEnvironment(environ []string, config *Config) (variables map[string]string, errors []error) {
+	variables = make(map[string]string)
+	for _, variable := range environ {
+		if !strings.HasPrefix(variable, ENV_PREFIX) {
+			continue
+		}
+		name, value := variable, ""
+		if index := strings.Index(variable, "="); index != -1 {
+			name, value = variable[:index], variable[index+1:]
+		}
+
+		key := strings.TrimPrefix(name, ENV_PREFIX)
+		if err := SetConfigValue(config, key, value); err != nil {
+			errors = append(errors, fmt.Errorf("%s: %s", name, err))
+		}
+		if _, found := configSetters[NormalizeKey(key)]; found {
+			variables[NormalizeKey(key)] = name
+		}
+	}
+	return variables, errors
+}
+
+// ReadEnvironment overwrites the configuration with the GOPLAY_<KEY> environment variables, problems are printed as warnings
+func ReadEnvironment(config *Config) {
+	variables, errors := ParseEnvironment(os.Environ(), config)
+	for _, err := range errors {
+		messageLog.Printf("warning: %s", err)
+	}
+	for key, name := range variables {
+		Verbosef("configuration value [%s] set by environment variable [%s]", key, name)
+		configSources[key] = "env " + name
+	}
+}
+
+// Read configuration and overwrite values if found, problems in the file are printed as warnings
+func ReadConfigurationFile(filename string, config *Config) bool {
+	if Exist(filename) {
+		Verbosef("reading configuration file [%s]", filename)
+		bytes, err := ioutil.ReadFile(filename)
+		if err != nil {
+			log.Fatalf("Could not read configuration file [%s]: %s", filename, err)
+		}
+		ApplyConfiguration(filename, bytes, config)
 		return true
 	}
 
 	return false
 }
+
+// ApplyConfiguration overwrites values with those of the content of a configuration file, problems are printed as warnings
+func ApplyConfiguration(filename string, bytes []byte, config *Config) {
+	lines, errors := ParseConfiguration(filename, bytes, config)
+	for _, err := range errors {
+		messageLog.Printf("warning: %s", err)
+	}
+	for key, line := range lines {
+		configSources[key] = fmt.Sprintf("%s:%d", filename, line)
+	}
+}
+
+// SignaturesRequired returns true if RequireSignature is set before reading the local configuration files,
+// by the configuration read so far, the explicitly selected configuration file or the environment
+func SignaturesRequired(explicitGoplayRc string) bool {
+	required := Config{RequireSignature: config.RequireSignature}
+	if explicitGoplayRc != "" {
+		if bytes, err := ioutil.ReadFile(explicitGoplayRc); err == nil {
+			ParseConfiguration(explicitGoplayRc, bytes, &required)
+		}
+	}
+	ParseEnvironment(os.Environ(), &required)
+	return required.RequireSignature
+}
@@ -7,8 +7,12 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -28,7 +32,7 @@ func TestContains(t *testing.T) {
 }
 
 func TestReadConfigurationFile(t *testing.T) {
-	config = Config{false, true, false, false, []string{"go"}, ".goplay"}
+	config = Config{CompleteBuild: true, HotReloadWatchExtensions: []string{"go"}, GoplayDirectory: ".goplay"}
 
 	found := ReadConfigurationFile("config/config.rc", &config)
 	if !found {
@@ -57,6 +61,10 @@ func TestReadConfigurationFile(t *testing.T) {
 	if config.GoplayDirectory != expectedDirectory {
 		t.Errorf("GoplayDirectory not as expected, was [%s], but should be [%s]", config.GoplayDirectory, expectedDirectory)
 	}
+	expectedBuildFlags := "-tags=Integration -ldflags=-X=main.Version=V1"
+	if config.BuildFlags != expectedBuildFlags {
+		t.Errorf("BuildFlags not as expected, was [%s], but should be [%s]", config.BuildFlags, expectedBuildFlags)
+	}
 }
 
 func TestLocalGoplayRc(t *testing.T) {
@@ -74,3 +82,174 @@ func TestLocalGoplayRc(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestParseConfiguration(t *testing.T) {
+	var config Config
+	data := []byte(`# Comment
+GoplayDirectory /Users/Foo/Bin
+hot_reload = Yes
+HotReloadWatchExtensions "go, tmpl"
+ForceCompile maybe
+Unknown_Key value
+`)
+
+	lines, errors := ParseConfiguration("test.rc", data, &config)
+	expected(t, "GoplayDirectory", config.GoplayDirectory, "/Users/Foo/Bin")
+	expected(t, "HotReload", config.HotReload, true)
+	expected(t, "HotReloadWatchExtensions", len(config.HotReloadWatchExtensions), 2)
+	expected(t, "HotReloadWatchExtensions", config.HotReloadWatchExtensions[1], "tmpl")
+	expected(t, "ParseConfiguration", lines["hotreload"], 3)
+	expected(t, "ParseConfiguration", lines["forcecompile"], 5)
+
+	if len(errors) != 2 {
+		t.Fatalf("Expected 2 errors, but got %d: %v", len(errors), errors)
+	}
+	expected(t, "ParseConfiguration", errors[0].Error(), "test.rc:5: invalid boolean [maybe], must be one of true/false, yes/no, on/off, 1/0")
+	expected(t, "ParseConfiguration", errors[1].Error(), "test.rc:6: unknown key [Unknown_Key]")
+}
+
+func TestParseBool(t *testing.T) {
+	for _, value := range []string{"yes", "Yes", "ON", "true", "True", "1"} {
+		if flag, err := ParseBool(value); !flag || err != nil {
+			t.Errorf("[%s] should be parsed as true", value)
+		}
+	}
+	for _, value := range []string{"no", "Off", "false", "0"} {
+		if flag, err := ParseBool(value); flag || err != nil {
+			t.Errorf("[%s] should be parsed as false", value)
+		}
+	}
+	if _, err := ParseBool("No way!"); err == nil {
+		t.Error("[No way!] should not be accepted as boolean")
+	}
+}
+
+func TestLocalConfigurationFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	scriptDir := filepath.Join(dir, "project", "cmd", "tools", "foo")
+	if err := os.MkdirAll(scriptDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile := func(filename string, content string) {
+		if err := ioutil.WriteFile(filepath.Join(dir, filename), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile(".goplayrc", "ForceCompile yes\n")
+	writeFile("project/go.mod", "module project\n")
+	writeFile("project/.goplayrc", "GoplayDirectory /tmp/project\n")
+	writeFile("project/cmd/tools/foo/.goplayrc", "ForceCompile yes\n")
+
+	// Search stops at the go.mod boundary, outermost files come first
+	files := LocalConfigurationFiles(scriptDir)
+	expected(t, "LocalConfigurationFiles", strings.Join(files, " "),
+		filepath.Join(dir, "project", ".goplayrc")+" "+filepath.Join(scriptDir, ".goplayrc"))
+
+	// Root stops the search as well
+	writeFile("project/cmd/.goplayrc", "Root yes\n")
+	files = LocalConfigurationFiles(scriptDir)
+	expected(t, "LocalConfigurationFiles", strings.Join(files, " "),
+		filepath.Join(dir, "project", "cmd", ".goplayrc")+" "+filepath.Join(scriptDir, ".goplayrc"))
+}
+
+func TestUntrustedConfigurationFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no permission bits on windows")
+	}
+	dir, err := ioutil.TempDir("", "goplay_config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Like /tmp, everybody can put files into the shared directory
+	shared := filepath.Join(dir, "shared")
+	scriptDir := filepath.Join(shared, "scripts")
+	if err := os.MkdirAll(scriptDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(shared, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(shared, ".goplayrc"), []byte("BuildFlags -toolexec=/tmp/evil.sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	local := filepath.Join(scriptDir, ".goplayrc")
+	if err := ioutil.WriteFile(local, []byte("ForceCompile yes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files := LocalConfigurationFiles(scriptDir)
+	expected(t, "LocalConfigurationFiles", strings.Join(files, " "), local)
+
+	// Configuration files writable by others are skipped as well
+	if err := os.Chmod(local, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckConfigurationFile(local); err == nil {
+		t.Errorf("[%s] should not be trusted, it is writable by everybody", local)
+	}
+	expected(t, "LocalConfigurationFiles", len(LocalConfigurationFiles(scriptDir)), 0)
+}
+
+func TestParseEnvironment(t *testing.T) {
+	config := Config{HotReloadWatchExtensions: []string{"go"}, GoplayDirectory: ".goplay"}
+	environ := []string{
+		"HOME=/home/user",
+		"GOPLAY_FORCECOMPILE=1",
+		"GOPLAY_GOPLAY_DIRECTORY=/Cache",
+		"GOPLAY_HOTRELOADWATCHEXTENSIONS=go,tmpl",
+		"GOPLAY_HOTRELOAD=maybe",
+		"GOPLAY_UNKNOWN=value",
+	}
+
+	variables, errors := ParseEnvironment(environ, &config)
+	if !config.ForceCompile {
+		t.Error("ForceCompile should now be set to 'true', but it is not")
+	}
+	expected(t, "GoplayDirectory", config.GoplayDirectory, "/Cache")
+	expected(t, "HotReloadWatchExtensions", strings.Join(config.HotReloadWatchExtensions, ","), "go,tmpl")
+	expected(t, "ParseEnvironment", variables["goplaydirectory"], "GOPLAY_GOPLAY_DIRECTORY")
+
+	if len(errors) != 2 {
+		t.Fatalf("Expected 2 errors, but got %d: %v", len(errors), errors)
+	}
+	expected(t, "ParseEnvironment", errors[1].Error(), "GOPLAY_UNKNOWN: unknown key [UNKNOWN]")
+}
+
+func TestExplicitConfigurationFile(t *testing.T) {
+	cmd := exec.Command("goplay", "-no-config", "config", "show", "output.go")
+	cmd.Env = append(os.Environ(), "GOPLAYRC=config/config.rc")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "GoplayDirectory") {
+			fields := strings.Fields(line)
+			expected(t, "GoplayDirectory", fields[1], ".goplay/test")
+			if !strings.HasPrefix(fields[2], "config/config.rc:") {
+				t.Errorf("GoplayDirectory should be set by [config/config.rc], but was set by [%s]", fields[2])
+			}
+			return
+		}
+	}
+	t.Errorf("GoplayDirectory not found in configuration:\n%s", out)
+}
+
+func TestParseLimit(t *testing.T) {
+	if limit, err := ParseLimit(" 30 "); limit != 30 || err != nil {
+		t.Errorf("[30] should be parsed as 30, but was %d (%v)", limit, err)
+	}
+	for _, value := range []string{"-1", "many", ""} {
+		if _, err := ParseLimit(value); err == nil {
+			t.Errorf("[%s] should not be accepted as limit", value)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// Descriptions of all configuration keys, used for the annotated configuration file template
+var configDescriptions = map[string]string{
+	"forcecompile":             "Forces recompilation every time",
+	"completebuild":            "Use \"go build\" for building complete binary out of script directory",
+	"hotreload":                "Watch for source file changes and recompile and reload if necessary",
+	"hotreloadrecursive":       "Watch recursively for source file changes, all subdirectories/files included",
+	"hotreloadwatchextensions": "File extensions to watch for file changes, for hot reload",
+	"goplaydirectory":          "Goplay directory for storing created binary files",
+	"buildflags":               "Additional flags for \"go build\", like -tags or -ldflags",
+	"root":                     "Do not look for further .goplayrc files in the parent directories",
+	"autoimports":              "Add missing and remove unused imports before compiling, the script itself is only changed with -fix",
+	"offline":                  "Never use the network for building, only the vendor directory or the module cache",
+	"gotoolchain":              "Go toolchain for building, a version like 1.22 or the path of a go binary, empty for the go command on the PATH",
+	"requiresignature":         "Only run scripts (and read local .goplayrc files) signed by a key in ~/.goplay/trusted_keys, can't be switched off again",
+	"sandboxcpu":               "CPU time limit in seconds for scripts run with -sandbox (RLIMIT_CPU), 0 for unlimited",
+	"sandboxmemory":            "Address space limit for scripts run with -sandbox (RLIMIT_AS), like 512M or 2G, empty for unlimited",
+	"sandboxfiles":             "Limit of open files for scripts run with -sandbox (RLIMIT_NOFILE), 0 for unlimited",
+}
+
+// ConfigField is a single configuration value, as shown by "goplay config show"
+type ConfigField struct {
+	Name   string
+	Value  string
+	Source string
+}
+
+// ConfigFields returns all fields of the configuration, in order of declaration, with their values formatted like in a configuration file
+func ConfigFields(config Config) (fields []ConfigField) {
+	value := reflect.ValueOf(config)
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Name
+		source, found := configSources[NormalizeKey(name)]
+		if !found {
+			source = "default"
+		}
+		fields = append(fields, ConfigField{name, FormatConfigValue(value.Field(i).Interface()), source})
+	}
+	return fields
+}
+
+// FormatConfigValue formats a configuration value, so that it can be read again from a configuration file
+func FormatConfigValue(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "yes"
+		}
+		return "no"
+	case FileExtensions:
+		return strings.Join(v, ",")
+	case string:
+		if v == "" || strings.TrimSpace(v) != v {
+			return fmt.Sprintf("%q", v)
+		}
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// ConfigCommand implements "goplay config show FILE" and "goplay config init [PATH]"
+func ConfigCommand(args []string) {
+	if len(args) == 0 {
+		usage()
+	}
+
+	switch args[0] {
+	case "show":
+		if len(args) != 2 {
+			usage()
+		}
+		scriptPath, err := filepath.Abs(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		ReadConfiguration(filepath.Dir(scriptPath))
+		ApplyFlags()
+		ShowConfiguration(os.Stdout, config)
+
+	case "init":
+		filename := "." + goplayRc
+		if len(args) > 1 {
+			filename = args[1]
+		}
+		if Exist(filename) {
+			log.Fatalf("Configuration file [%s] already exists", filename)
+		}
+		if err := ioutil.WriteFile(filename, []byte(ConfigTemplate(config)), 0644); err != nil {
+			log.Fatalf("Could not write configuration file: %s", err)
+		}
+		fmt.Printf("Created configuration file [%s]\n", filename)
+
+	default:
+		usage()
+	}
+}
+
+// ShowConfiguration prints every configuration field, its effective value and where it came from
+func ShowConfiguration(writer io.Writer, config Config) {
+	fields := ConfigFields(config)
+	nameWidth, valueWidth := 0, 0
+	for _, field := range fields {
+		if len(field.Name) > nameWidth {
+			nameWidth = len(field.Name)
+		}
+		if len(field.Value) > valueWidth {
+			valueWidth = len(field.Value)
+		}
+	}
+	for _, field := range fields {
+		fmt.Fprintf(writer, "%-*s  %-*s  %s\n", nameWidth, field.Name, valueWidth, field.Value, field.Source)
+	}
+}
+
+// ConfigTemplate returns an annotated configuration file, with all keys commented out and set to their default values
+func ConfigTemplate(defaults Config) string {
+	lines := []string{"# goplay configuration file, see \"goplay config show FILE\" for the effective configuration"}
+	for _, field := range ConfigFields(defaults) {
+		lines = append(lines, "", "# "+configDescriptions[NormalizeKey(field.Name)], "#"+field.Name+" "+field.Value)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,49 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestConfigTemplate(t *testing.T) {
+	defaults := Config{HotReload: true, HotReloadWatchExtensions: []string{"go", "tmpl"}, GoplayDirectory: ".goplay"}
+	template := ConfigTemplate(defaults)
+
+	// Every key has a description
+	if strings.Contains(template, "# \n") {
+		t.Errorf("Configuration template contains keys without description:\n%s", template)
+	}
+
+	// Uncommenting all keys of the template has to result in the same configuration
+	var parsed Config
+	uncommented := regexp.MustCompile(`(?m)^#([A-Z])`).ReplaceAllString(template, "$1")
+	if _, errors := ParseConfiguration("template", []byte(uncommented), &parsed); len(errors) != 0 {
+		t.Fatalf("Uncommented template should not contain any errors: %v", errors)
+	}
+	if !reflect.DeepEqual(parsed, defaults) {
+		t.Errorf("Configuration from template should be [%v], but was [%v]", defaults, parsed)
+	}
+}
+
+func TestShowConfiguration(t *testing.T) {
+	config := Config{ForceCompile: true, HotReloadWatchExtensions: []string{"go"}, GoplayDirectory: ".goplay"}
+	configSources = map[string]string{"forcecompile": "flag -f"}
+	defer func() { configSources = make(map[string]string) }()
+
+	var buffer bytes.Buffer
+	ShowConfiguration(&buffer, config)
+	lines := strings.Split(buffer.String(), "\n")
+
+	expected(t, "ShowConfiguration", strings.Join(strings.Fields(lines[0]), " "), "ForceCompile yes flag -f")
+	expected(t, "ShowConfiguration", strings.Join(strings.Fields(lines[1]), " "), "CompleteBuild no default")
+	expected(t, "ShowConfiguration", strings.Join(strings.Fields(lines[6]), " "), `BuildFlags "" default`)
+}
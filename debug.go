@@ -0,0 +1,37 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"log"
+	"os/exec"
+)
+
+// DebuggerCommand returns the "dlv exec" command for debugging the binary.
+// If listen is set, delve is started as a headless server on that address, so that editors can connect to it.
+// In hot reload mode the debugger is simply restarted together with the rebuilt binary.
+func DebuggerCommand(binaryPath string, args []string, listen string) *exec.Cmd {
+	dlv, err := exec.LookPath("dlv")
+	if err != nil {
+		log.Fatalf("Could not find delve (dlv) for debugging, install it with \"go install github.com/go-delve/delve/cmd/dlv@latest\": %s", err)
+	}
+	return exec.Command(dlv, DebuggerArgs(binaryPath, args, listen)...)
+}
+
+// DebuggerArgs returns the arguments for "dlv exec"
+func DebuggerArgs(binaryPath string, args []string, listen string) []string {
+	dlvArgs := []string{"exec"}
+	if listen != "" {
+		dlvArgs = append(dlvArgs, "--headless", "--listen="+listen, "--api-version=2", "--accept-multiclient")
+	}
+	dlvArgs = append(dlvArgs, binaryPath)
+	if len(args) > 0 {
+		dlvArgs = append(dlvArgs, "--")
+		dlvArgs = append(dlvArgs, args...)
+	}
+	return dlvArgs
+}
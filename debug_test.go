@@ -0,0 +1,34 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDebuggerArgs(t *testing.T) {
+	expected(t, "DebuggerArgs", strings.Join(DebuggerArgs("/tmp/script", nil, ""), " "), "exec /tmp/script")
+	expected(t, "DebuggerArgs", strings.Join(DebuggerArgs("/tmp/script", []string{"-f", "One"}, ":2345"), " "),
+		"exec --headless --listen=:2345 --api-version=2 --accept-multiclient /tmp/script -- -f One")
+}
+
+func TestDebugBuildOptions(t *testing.T) {
+	options := BuildOptions{Debug: true}
+	expected(t, "GoBuildArgs", strings.Join(options.GoBuildArgs(), " "), "-gcflags all=-N -l")
+
+	// The users -gcflags are separate arguments, keeping their package pattern
+	for gcflags, want := range map[string]string{"-m": "-N -l -m", "main=-m": "main=-N -l -m", "-d=ssa/check/on": "-N -l -d=ssa/check/on"} {
+		options := BuildOptions{Debug: true, GcFlags: gcflags}
+		expected(t, "GoBuildArgs", strings.Join(options.GoBuildArgs(), "|"), "-gcflags|all=-N -l|-gcflags|"+want)
+	}
+
+	// Debug binaries must not overwrite the normal ones
+	if options.CacheKey() == "" {
+		t.Error("Debug builds should have their own cache key")
+	}
+}
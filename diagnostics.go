@@ -0,0 +1,75 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// BuildError holds the compiler output of a failed build, with all positions already mapped back to the original script(s)
+type BuildError struct {
+	Output string
+}
+
+func (e *BuildError) Error() string {
+	return e.Output
+}
+
+// Source describes where a file handed to the compiler originally came from
+type Source struct {
+	Path       string // Path of the users original script
+	LineOffset int    // Number of lines that were added in front of the original content
+}
+
+// SourceMap maps the absolute paths of compiled files to their original source
+type SourceMap map[string]Source
+
+// Compiler positions "file:line:col: message", the file may start with a Windows drive letter like "C:\scripts\script.go"
+var positionRx = regexp.MustCompile(`^(\s*)((?:[A-Za-z]:)?[^\s:][^:]*):(\d+)(:\d+)?(:.*)$`)
+
+// Paths with a drive letter are absolute, filepath.IsAbs only knows that on Windows
+var driveRx = regexp.MustCompile(`^[A-Za-z]:[\\/]`)
+
+// MapBuildOutput rewrites all "file:line:col" positions in the compiler output,
+// so that they point to the original script paths and lines.
+// Relative paths are resolved against dir, package headers ("# command-line-arguments") are dropped.
+func MapBuildOutput(out []byte, dir string, sources SourceMap) string {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		if strings.HasPrefix(line, "# ") || line == "" {
+			continue
+		}
+
+		match := positionRx.FindStringSubmatch(line)
+		if match == nil {
+			lines = append(lines, line)
+			continue
+		}
+
+		path := match[2]
+		if !filepath.IsAbs(path) && !driveRx.MatchString(path) {
+			path = filepath.Join(dir, path)
+		}
+		lineNum, _ := strconv.Atoi(match[3])
+		if source, found := sources[filepath.Clean(path)]; found {
+			path = source.Path
+			lineNum -= source.LineOffset
+			if lineNum < 1 {
+				lineNum = 1
+			}
+		}
+		lines = append(lines, match[1]+path+":"+strconv.Itoa(lineNum)+match[4]+match[5])
+	}
+
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,35 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"testing"
+)
+
+func TestMapBuildOutput(t *testing.T) {
+	out := []byte("# command-line-arguments\n" +
+		"./builder.go:10:14: undefined: data\n" +
+		"/tmp/goplay/script.go:7:2: \"strings\" imported and not used\n" +
+		"note: module requires Go 1.22\n")
+	sources := SourceMap{"/tmp/goplay/script.go": Source{"/home/user/script", 3}}
+
+	expected(t, "MapBuildOutput", MapBuildOutput(out, "/home/user/build", sources),
+		"/home/user/build/builder.go:10:14: undefined: data\n"+
+			"/home/user/script:4:2: \"strings\" imported and not used\n"+
+			"note: module requires Go 1.22\n")
+
+	// Old compilers did not print columns
+	expected(t, "MapBuildOutput", MapBuildOutput([]byte("output.go:5: undefined: fmt.Printl\n"), "/home/user", nil),
+		"/home/user/output.go:5: undefined: fmt.Printl\n")
+
+	expected(t, "MapBuildOutput", MapBuildOutput([]byte("# command-line-arguments\n"), "/home/user", nil), "")
+
+	// Windows paths start with a drive letter
+	out = []byte("C:\\Temp\\goplay\\script.go:5:2: undefined: data\n")
+	sources = SourceMap{"C:\\Temp\\goplay\\script.go": Source{"C:\\Users\\user\\script", 3}}
+	expected(t, "MapBuildOutput", MapBuildOutput(out, "C:\\Users\\user", sources), "C:\\Users\\user\\script:2:2: undefined: data\n")
+}
@@ -0,0 +1,95 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// Prefix of all goplay directives inside a script, like "//goplay:build -race"
+const DIRECTIVE = "//goplay:"
+
+// ReadDirectives returns the values of all "//goplay:name value" lines in the script, in order of appearance.
+// Directives have to start at the beginning of a line.
+func ReadDirectives(scriptPath string, name string) (values []string) {
+	src, err := ioutil.ReadFile(scriptPath)
+	if err != nil {
+		log.Fatalf("Could not read file: %s", err)
+	}
+	return ParseDirectives(src, name)
+}
+
+// ParseDirectives returns the values of all "//goplay:name value" lines in the source of a script, like ReadDirectives
+func ParseDirectives(src []byte, name string) (values []string) {
+	prefix := DIRECTIVE + name
+	for _, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimRight(line, "\r\t ")
+		if line == prefix {
+			values = append(values, "")
+		} else if strings.HasPrefix(line, prefix+" ") || strings.HasPrefix(line, prefix+"\t") {
+			values = append(values, strings.TrimSpace(line[len(prefix):]))
+		}
+	}
+	return values
+}
+
+// SplitWords splits s into words like a POSIX shell, so that flags like -ldflags "-s -w" or -ldflags='-X main.v=1' stay together.
+// Single quotes keep everything literally, a backslash escapes the next character outside of quotes, and " or \\ inside double quotes.
+func SplitWords(s string) (words []string, err error) {
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\\':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("trailing backslash in [%s]", s)
+			}
+			if next := runes[i+1]; quote == 0 || next == '"' || next == '\\' {
+				r = next
+				i++
+			}
+			word.WriteRune(r)
+			inWord = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("missing closing quote %c in [%s]", quote, s)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
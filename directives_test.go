@@ -0,0 +1,38 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadDirectives(t *testing.T) {
+	directives := ReadDirectives("directives.go", "build")
+	expected(t, "ReadDirectives", strings.Join(directives, "|"), "-race|-tags=integration")
+
+	if len(ReadDirectives("output.go", "build")) != 0 {
+		t.Error("output.go should not contain any directives")
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	words, err := SplitWords(`-ldflags "-s -w" -ldflags='-X main.v=1 -s'  -tags=a\ b -gcflags="all=\"-N\" C:\go"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "SplitWords", strings.Join(words, "|"), `-ldflags|-s -w|-ldflags=-X main.v=1 -s|-tags=a b|-gcflags=all="-N" C:\go`)
+
+	if words, _ := SplitWords(" \t"); len(words) != 0 {
+		t.Errorf("Blank input should not have any words, but got %q", words)
+	}
+	for _, invalid := range []string{`-ldflags="-s -w`, `-ldflags='-s`, `-tags=a\`} {
+		if _, err := SplitWords(invalid); err == nil {
+			t.Errorf("[%s] should not be split", invalid)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Target is a single GOOS/GOARCH combination to build for
+type Target struct {
+	OS   string
+	Arch string
+}
+
+func (t Target) String() string {
+	return t.OS + "/" + t.Arch
+}
+
+// ParseTargets parses a comma separated list of GOOS/GOARCH pairs, like "linux/amd64,darwin/arm64"
+func ParseTargets(value string) ([]Target, error) {
+	var targets []Target
+	for _, target := range strings.Split(value, ",") {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		parts := strings.Split(target, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("Invalid target [%s], must be GOOS/GOARCH", target)
+		}
+		targets = append(targets, Target{parts[0], parts[1]})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("No targets given")
+	}
+	return targets, nil
+}
+
+// DistCommand implements "goplay dist", which cross-compiles a script for several targets,
+// optionally archives each binary, and writes the checksums of all files into SHA256SUMS
+func DistCommand(args []string) {
+	var options BuildOptions
+	flags := NewBuildFlagSet("dist", &options)
+	targetsFlag := flags.String("targets", Target{BuildOptions{}.OS(), BuildOptions{}.Arch()}.String(), "comma separated list of GOOS/GOARCH targets")
+	outputDir := flags.String("o", "dist", "output directory")
+	archive := flags.Bool("archive", false, "archive each binary, zip for windows and tar.gz for everything else")
+
+	files := ParseInterspersed(flags, args)
+	if len(files) != 1 {
+		usage()
+	}
+	targets, err := ParseTargets(*targetsFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	scriptPath := ReadBuildConfiguration(files[0])
+	options.ReadScript(scriptPath)
+
+	distDir, err := filepath.Abs(*outputDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !Exist(distDir) {
+		if err := os.MkdirAll(distDir, 0755); err != nil {
+			log.Fatalf("Could not make directory: %s", err)
+		}
+	}
+
+	var artifacts []string
+	for _, target := range targets {
+		options.GOOS, options.GOARCH = target.OS, target.Arch
+
+		scriptName := filepath.Base(scriptPath)
+		binaryName := BinaryName(scriptName, target.OS)
+		name := strings.TrimSuffix(scriptName, ".go") + "_" + target.OS + "_" + target.Arch
+		binaryPath := filepath.Join(distDir, BinaryName(name, target.OS))
+
+		Verbosef("building [%s] for [%s]", binaryPath, target)
+		CompileBinary(scriptPath, binaryPath, config.CompleteBuild, options)
+		if *dryRunFlag {
+			continue
+		}
+
+		if *archive {
+			var archivePath string
+			if target.OS == "windows" {
+				archivePath = filepath.Join(distDir, name+".zip")
+				err = ZipFile(archivePath, binaryPath, binaryName)
+			} else {
+				archivePath = filepath.Join(distDir, name+".tar.gz")
+				err = TarGzFile(archivePath, binaryPath, binaryName)
+			}
+			if err != nil {
+				log.Fatalf("Could not create archive [%s]: %s", archivePath, err)
+			}
+			artifacts = append(artifacts, archivePath)
+		}
+		artifacts = append(artifacts, binaryPath)
+	}
+	if *dryRunFlag {
+		return
+	}
+
+	if err := WriteChecksums(filepath.Join(distDir, "SHA256SUMS"), artifacts); err != nil {
+		log.Fatalf("Could not write checksums: %s", err)
+	}
+}
+
+// WriteChecksums writes the sha256 checksums of all files in the format of sha256sum(1)
+func WriteChecksums(filename string, files []string) error {
+	var sums []string
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		sums = append(sums, fmt.Sprintf("%x  %s\n", sha256.Sum256(data), filepath.Base(file)))
+	}
+	return ioutil.WriteFile(filename, []byte(strings.Join(sums, "")), 0644)
+}
+
+// TarGzFile writes a tar.gz archive containing only the given file, stored as name
+func TarGzFile(archivePath string, filename string, name string) error {
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	gzipWriter := gzip.NewWriter(archive)
+	tarWriter := tar.NewWriter(gzipWriter)
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tarWriter, file); err != nil {
+		return err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// ZipFile writes a zip archive containing only the given file, stored as name
+func ZipFile(archivePath string, filename string, name string) error {
+	archive, err := os.Create(archivePath)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	zipWriter := zip.NewWriter(archive)
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	writer, err := zipWriter.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, file); err != nil {
+		return err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	return archive.Close()
+}
@@ -0,0 +1,111 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"debug/elf"
+	"debug/macho"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTargets(t *testing.T) {
+	targets, err := ParseTargets("linux/amd64, darwin/arm64,windows/amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "ParseTargets", len(targets), 3)
+	expected(t, "ParseTargets", targets[1], Target{"darwin", "arm64"})
+	expected(t, "ParseTargets", targets[2].String(), "windows/amd64")
+
+	for _, invalid := range []string{"", "linux", "linux/", "linux/amd64/v2"} {
+		if _, err := ParseTargets(invalid); err == nil {
+			t.Errorf("Targets [%s] should not be accepted", invalid)
+		}
+	}
+}
+
+func TestWriteChecksumsAndArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay_dist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	binaryPath := filepath.Join(dir, "tool_linux_amd64")
+	if err := ioutil.WriteFile(binaryPath, []byte("Hello, World!"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	checksums := filepath.Join(dir, "SHA256SUMS")
+	if err := WriteChecksums(checksums, []string{binaryPath}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(checksums)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "WriteChecksums", string(data), "dffd6021bb2bd5b0af676290809ec3a53191dd81c7f70a4b28688a362182986f  tool_linux_amd64\n")
+
+	archivePath := filepath.Join(dir, "tool_linux_amd64.tar.gz")
+	if err := TarGzFile(archivePath, binaryPath, "tool"); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+	gzipReader, err := gzip.NewReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := tar.NewReader(gzipReader).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "TarGzFile", header.Name, "tool")
+	expected(t, "TarGzFile", header.Mode&0111 != 0, true)
+}
+
+func TestDistCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay_dist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if out, err := exec.Command("goplay", "dist", "-targets", "linux/arm64,darwin/arm64", "-o", dir, "output.go").CombinedOutput(); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+
+	linux, err := elf.Open(filepath.Join(dir, "output_linux_arm64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer linux.Close()
+	expected(t, "DistCommand", linux.Machine, elf.EM_AARCH64)
+
+	darwin, err := macho.Open(filepath.Join(dir, "output_darwin_arm64"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer darwin.Close()
+	expected(t, "DistCommand", darwin.Cpu, macho.CpuArm64)
+
+	sums, err := ioutil.ReadFile(filepath.Join(dir, "SHA256SUMS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "DistCommand", strings.Count(string(sums), "\n"), 2)
+}
@@ -0,0 +1,108 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	EventCache        = "cache"
+	EventBuildStart   = "build-start"
+	EventBuildEnd     = "build-end"
+	EventProcessStart = "process-start"
+	EventProcessExit  = "process-exit"
+	EventFileChange   = "file-change"
+)
+
+// Event is a single machine-readable build or reload event
+type Event struct {
+	Time        time.Time `json:"time"`
+	Type        string    `json:"type"`
+	Script      string    `json:"script,omitempty"`
+	Binary      string    `json:"binary,omitempty"`
+	Cache       string    `json:"cache,omitempty"`  // "hit" or "miss"
+	Reason      string    `json:"reason,omitempty"` // Why the cache was missed
+	Success     *bool     `json:"success,omitempty"`
+	DurationMs  *int64    `json:"duration_ms,omitempty"` // Set on build-end, even for builds below a millisecond
+	Diagnostics []string  `json:"diagnostics,omitempty"`
+	Pid         int       `json:"pid,omitempty"`
+	ExitCode    *int      `json:"exit_code,omitempty"`
+	File        string    `json:"file,omitempty"`
+}
+
+// EventStream writes events as JSON lines, one event per line
+type EventStream struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+// The event stream, nil if events are disabled
+var events *EventStream
+
+// NewEventStream returns an EventStream for the given -events value.
+// "json" writes to stderr, where events are mixed with the output of the compiler and the script,
+// "json=PATH" appends to the file at PATH instead, like /dev/fd/3 for a descriptor passed in by the caller,
+// "unix:PATH" connects to the Unix socket at PATH.
+func NewEventStream(target string) (*EventStream, error) {
+	var writer io.Writer
+	switch {
+	case target == "json":
+		writer = os.Stderr
+	case strings.HasPrefix(target, "json="):
+		file, err := os.OpenFile(strings.TrimPrefix(target, "json="), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		writer = file
+	case strings.HasPrefix(target, "unix:"):
+		conn, err := net.Dial("unix", strings.TrimPrefix(target, "unix:"))
+		if err != nil {
+			return nil, err
+		}
+		writer = conn
+	default:
+		return nil, fmt.Errorf("Unknown event target [%s], must be [json], [json=PATH] or [unix:PATH]", target)
+	}
+	return &EventStream{encoder: json.NewEncoder(writer)}, nil
+}
+
+// Emit writes the event, it does nothing if the stream is nil
+func (s *EventStream) Emit(event Event) {
+	if s == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	// Events are best effort, a vanished listener must not break the script
+	s.encoder.Encode(event)
+}
+
+// Helpers for the optional event fields
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func int64Ptr(i int64) *int64 {
+	return &i
+}
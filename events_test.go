@@ -0,0 +1,67 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventStream(t *testing.T) {
+	// A nil stream must silently drop events
+	var stream *EventStream
+	stream.Emit(Event{Type: EventBuildStart})
+
+	var buffer bytes.Buffer
+	stream = &EventStream{encoder: json.NewEncoder(&buffer)}
+	stream.Emit(Event{Time: time.Unix(0, 0).UTC(), Type: EventProcessExit, Pid: 42, ExitCode: intPtr(0)})
+	expected(t, "EventStream", buffer.String(), `{"time":"1970-01-01T00:00:00Z","type":"process-exit","pid":42,"exit_code":0}`+"\n")
+
+	// Builds below a millisecond still carry their duration
+	buffer.Reset()
+	stream.Emit(Event{Time: time.Unix(0, 0).UTC(), Type: EventBuildEnd, Success: boolPtr(true), DurationMs: int64Ptr(0)})
+	expected(t, "EventStream", buffer.String(), `{"time":"1970-01-01T00:00:00Z","type":"build-end","success":true,"duration_ms":0}`+"\n")
+
+	for _, target := range []string{"xml", "jsonl", "unix"} {
+		if _, err := NewEventStream(target); err == nil {
+			t.Errorf("Event target [%s] should not be accepted", target)
+		}
+	}
+	if stream, err := NewEventStream("json"); err != nil || stream.encoder == nil {
+		t.Errorf("Event target [json] should write to stderr, but was refused: %v", err)
+	}
+}
+
+func TestEventStreamFile(t *testing.T) {
+	file, err := ioutil.TempFile("", "goplay_events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	defer os.Remove(file.Name())
+
+	stream, err := NewEventStream("json=" + file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Emit(Event{Type: EventCache, Cache: "hit"})
+	stream.Emit(Event{Type: EventBuildStart})
+
+	data, _ := ioutil.ReadFile(file.Name())
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	expected(t, "EventStream", len(lines), 2)
+	var event Event
+	if err := json.Unmarshal([]byte(lines[0]), &event); err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "EventStream", event.Cache, "hit")
+}
@@ -7,7 +7,7 @@
 
 // The 'goplay' command enables you to use Go as if it were an interpreted scripting language.
 //
-// Internally, it compiles and links the Go source file, saving the resulting executable under the local directory ".goplay",
+// Internally, it builds the Go source file with "go build", saving the resulting executable under the local directory ".goplay",
 // or any other directory specified by the configuration file ~/.goplayrc.
 // After that it is executed with all commandline parameters passed along.
 // If that executable does not yet exist or its modified time is different than the scripts,
@@ -38,6 +38,8 @@
 //
 // Optional configuration files are read in the following order: /etc/goplayrc, ~/.goplayrc, $GO_SOURCE_FILE_DIR/.goplayrc
 // The third option allows each project (directory) to contain it's own .goplayrc configuration file.
+// The .goplayrc files of all parent directories up to the project root (containing go.mod or .git) are read as well, outermost first.
+// Every configuration value can be overwritten with an environment variable, like GOPLAY_FORCECOMPILE=1.
 package main
 
 import (
@@ -46,6 +48,7 @@ import (
 	"flag"
 	"fmt"
 	"go/build"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
@@ -70,117 +73,437 @@ var (
 		false,          // Recursively watch files/folders for hot reload
 		[]string{"go"}, // File extensions to watch for file changes for hot reload
 		".goplay",      // Where to store the compiled programs
+		"",             // Additional flags for "go build"
+		false,          // Stop looking for .goplayrc files in parent directories
+		false,          // Add missing and remove unused imports before compiling
+		false,          // Never use the network for building, only the vendor directory or the module cache
+		"",             // Go toolchain for building, empty for the go command on the PATH
+		false,          // Only run scripts signed by a trusted key
+		0,              // CPU time limit in seconds for -sandbox, 0 for unlimited
+		"",             // Address space limit for -sandbox, like 512M, empty for unlimited
+		0,              // Open files limit for -sandbox, 0 for unlimited
 	}
 	forceCompileFlag    = flag.Bool("f", false, "force compilation")                               // Force compilation flag
 	completeBuildFlag   = flag.Bool("b", false, "complete build")                                  // Build complete binary out of script directory
 	reloadFlag          = flag.Bool("r", false, "reload on file changes")                          // Watch for source file changes and recompile and reload if necessary
 	recursiveReloadFlag = flag.Bool("R", false, "watch files/directories recursively for changes") // Watch recursively for source file changes
+	eventsFlag          = flag.String("events", "", "emit build and reload events")                // Machine-readable event stream, "json", "json=PATH" or "unix:PATH"
+	verboseFlag         = flag.Bool("v", false, "verbose output")                                  // Explain configuration, cache decisions and build commands
+	dryRunFlag          = flag.Bool("n", false, "dry run")                                         // Print what would be built and executed, without doing it
+	tagsFlag            = flag.String("tags", "", "build tags")                                    // Comma separated list of build tags
+	raceFlag            = flag.Bool("race", false, "enable race detector")                         // Build with the race detector
+	ldFlagsFlag         = flag.String("ldflags", "", "linker flags")                               // Flags passed to the linker
+	gcFlagsFlag         = flag.String("gcflags", "", "compiler flags")                             // Flags passed to the compiler
+	debugFlag           = flag.Bool("debug", false, "run under delve")                             // Build without optimizations and start the binary with "dlv exec"
+	debugListenFlag     = flag.String("debug-listen", "", "run headless delve")                    // Start a headless delve server on the given address
+	sandboxFlag         = flag.Bool("sandbox", false, "run in a sandbox")                          // Run the binary with a read-only filesystem, without network and with resource limits
+	netFlag             = flag.Bool("net", false, "keep network in the sandbox")                   // Allow network access inside the sandbox
+	evalFlag            = flag.String("e", "", "run code")                                         // Go code to run, wrapped into func main if necessary
+	fixFlag             = flag.Bool("fix", false, "fix imports of the script")                     // Write the fixed imports back to the script, with AutoImports
+	includeFlag         = flag.String("include", "", "additional source files")                    // Space separated file patterns compiled together with the script
+	configFlag          = flag.String("config", "", "configuration file")                          // Explicit configuration file, read after all others
+	noConfigFlag        = flag.Bool("no-config", false, "skip system and user configuration")      // Do not read /etc/goplayrc and ~/.goplayrc
 	goplayRc            = "goplayrc"                                                               // Configration filename
 	systemGoplayRc      = filepath.Join(string(os.PathSeparator)+"etc", goplayRc)                  // Systemwide goplay configuration file
 	userGoplayRc        = filepath.Join(os.Getenv("HOME"), "."+goplayRc)                           // User goplay configuration file
+	messageLog          = log.New(os.Stderr, "goplay: ", 0)                                        // Logger for goplays own messages, like warnings and verbose output
+	versionFlag         = flag.Bool("version", false, "print version")                             // Print version information
 )
 
+// Long versions of the single letter options
+func init() {
+	flag.BoolVar(forceCompileFlag, "force", false, "force compilation")
+	flag.BoolVar(completeBuildFlag, "build", false, "complete build")
+	flag.BoolVar(reloadFlag, "reload", false, "reload on file changes")
+	flag.BoolVar(recursiveReloadFlag, "recursive", false, "watch files/directories recursively for changes")
+	flag.BoolVar(verboseFlag, "verbose", false, "verbose output")
+	flag.BoolVar(dryRunFlag, "dry-run", false, "dry run")
+}
+
+// Prints the usage message and exits with an error
 func usage() {
+	printUsage()
+	os.Exit(1)
+}
+
+func printUsage() {
 	fmt.Fprintf(os.Stderr, `Compile and run a Go source file.
 To run the Go source file directly from shell, insert hashbang "#!/usr/bin/env goplay" as the first line.
 
-Usage: goplay [OPTION]... FILE
+Usage: goplay [OPTION]... [--] FILE [ARGUMENT]...
+       goplay [OPTION]... -e CODE [ARGUMENT]...
+       goplay [OPTION]... - [ARGUMENT]...
+       goplay run [OPTION]... [--] FILE [ARGUMENT]...
+       goplay watch [OPTION]... [--] FILE [ARGUMENT]...
+       goplay build [BUILD OPTION]... FILE
+       goplay dist [BUILD OPTION]... -targets GOOS/GOARCH,... FILE
+       goplay cache dir|clean FILE
+       goplay config show FILE
+       goplay config init [PATH]
+       goplay version
+       goplay completion bash|zsh|fish
+       goplay repl
+       goplay deps [-vendor] FILE
+       goplay sign [-embed] [-key FILE] FILE...
+
+All arguments after FILE are passed along to the script, "--" ends the options in front of FILE.
+With -e or FILE "-" (stdin), Go code is run directly, wrapped into func main if necessary and with its imports added automatically.
+FILE does not need a ".go" extension, and may leave out the package clause and func main (script mode).
+
+Commands:
+	run		compile FILE if necessary and run it (the default)
+	watch		same as run -r
+	build		compile FILE into a standalone binary, without running it
+	dist		compile FILE for several targets at once
+	cache		print the cache directory of FILE, or remove its cached binaries
+	config		show the effective configuration, or create an annotated configuration file
+	version		print version information
+	completion	print the shell completion script for bash, zsh or fish
+	repl		start an interactive session, see :help inside for its commands
+	deps		download (or with -vendor, vendor) everything FILE needs for building offline
+	sign		sign FILE with ~/.goplay/signing_key into FILE.sig, or with -embed as its last line
 
 Options:
-	-f		force (re)compilation of source file.
+	-e CODE		run CODE instead of FILE, like -e 'fmt.Println(os.Getenv("HOME"))'
+	-f, --force	force (re)compilation of source file.
+	-b, --build	use "go build" to build complete binary out of FILE directory
+	-r, --reload	Watch for changes in FILE and recompile and reload if necessary (enables force compilation [-f])
+	-R, --recursive	Watch recursively for file changes (enables [-r])
+	-tags TAGS	comma separated list of build tags
+	-race		enable the race detector
+	-ldflags FLAGS	pass FLAGS to the linker
+	-gcflags FLAGS	pass FLAGS to the compiler
+	-debug		build without optimizations and run FILE under the delve debugger ("dlv exec")
+	-debug-listen ADDR
+			run a headless delve server listening on ADDR, like ":2345" (enables [-debug])
+	-sandbox	run FILE in a sandbox (linux only): read-only filesystem except for the FILE directory and the temp directory,
+			no network, no secret environment variables, a seccomp filter and the resource limits SandboxCPU, SandboxMemory and SandboxFiles
+	-net		keep network access inside the sandbox
+	-config FILE	read configuration FILE after all others (defaults to $GOPLAYRC)
+	-no-config	do not read the system and user configuration files /etc/goplayrc and ~/.goplayrc
+	-fix		fix the imports of FILE like AutoImports and write them back into FILE (enables [-f])
+	-include FILES	space separated list of files (or patterns) to compile together with FILE, like //goplay:include
+	-v, --verbose	Verbose output, explains loaded configuration files, cache decisions and build commands
+	-n, --dry-run	Dry run, print what would be built and executed without doing it (enables [-v])
+	-events json	Emit build and reload events as JSON lines to stderr
+	-events json=PATH
+			Emit build and reload events as JSON lines to the file PATH, like /dev/fd/3
+	-events unix:PATH
+			Emit build and reload events as JSON lines to the Unix socket at PATH
+	-h, --help	print this message
+	--version	print version information
+
+Build options:
+	-o FILE		write the binary to FILE instead of the scripts name in the current directory
 	-b		use "go build" to build complete binary out of FILE directory
-	-r		Watch for changes in FILE and recompile and reload if necessary (enables force compilation [-f])
-	-R		Watch recursively for file changes (enables [-r])
+	-os GOOS	cross-compile for the given operating system (defaults to $GOOS)
+	-arch GOARCH	cross-compile for the given architecture (defaults to $GOARCH)
+	-ldflags FLAGS	pass FLAGS to the linker
+	-trimpath	remove file system paths from the binary
+	-static		build a static binary (CGO_ENABLED=0)
+	-tags, -race, -gcflags	same as above
+
+Dist options:
+	-targets LIST	comma separated list of GOOS/GOARCH targets to build (defaults to the current platform)
+	-o DIR		write binaries, archives and SHA256SUMS to DIR (defaults to "dist")
+	-archive	also archive each binary, as zip for windows and tar.gz for all other targets
 `)
-	os.Exit(1)
 }
 
 func main() {
-	// Return custom usage message in case of invalid/unknown flags
-	flag.Usage = usage
+	if len(os.Args) > 1 && os.Args[1] == SANDBOX_INIT {
+		SandboxInit(os.Args[2:]) // goplay inside the sandbox, which starts the binary
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == SANDBOX_EXEC {
+		SandboxExec(os.Args[2:]) // goplay inside the sandbox, which restricts itself and becomes the binary
+		return
+	}
 
-	flag.Parse()
+	// Return custom usage message in case of invalid/unknown flags
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	flag.Usage = printUsage
+	ParseFlags(flag.CommandLine, os.Args[1:])
+	if *versionFlag {
+		VersionCommand()
+		return
+	}
+	if *evalFlag != "" {
+		RunCommand(flag.Args()) // All arguments belong to the snippet
+		return
+	}
 	if flag.NArg() == 0 {
 		usage()
 	}
 
-	// Script paths
-	scriptPath, err := filepath.Abs(flag.Args()[0])
-	if err != nil {
-		log.Fatal(err)
+	// Subcommands, global options are allowed before and after the subcommand
+	switch flag.Arg(0) {
+	case "run":
+		ParseFlags(flag.CommandLine, flag.Args()[1:])
+		RunCommand(flag.Args())
+	case "watch":
+		ParseFlags(flag.CommandLine, flag.Args()[1:])
+		*reloadFlag = true
+		RunCommand(flag.Args())
+	case "build":
+		BuildCommand(flag.Args()[1:])
+	case "dist":
+		DistCommand(flag.Args()[1:])
+	case "cache":
+		CacheCommand(flag.Args()[1:])
+	case "config":
+		ConfigCommand(flag.Args()[1:])
+	case "version":
+		VersionCommand()
+	case "completion":
+		CompletionCommand(flag.Args()[1:])
+	case "repl":
+		ReplCommand(flag.Args()[1:])
+	case "deps":
+		DepsCommand(flag.Args()[1:])
+	case "sign":
+		SignCommand(flag.Args()[1:])
+	default:
+		RunCommand(flag.Args())
 	}
-	scriptDir, scriptName := filepath.Split(scriptPath)
-
-	// Read configuration from /etc/goplayrc, ~/.goplayrc, $PWD/.goplayrc, and overwrite values if found in configuration file
-	ReadConfigurationFile(systemGoplayRc, &config)
-	ReadConfigurationFile(userGoplayRc, &config)
-	// This allows each script(directory) to have a local .goplayrc that takes precedence over the other 2 configuration files
-	ReadConfigurationFile(filepath.Join(scriptDir, "."+goplayRc), &config)
+}
 
-	// Commandline flags take precedence over configuration file values
-	if *forceCompileFlag {
-		config.ForceCompile = true
+// RunCommand compiles the script if necessary and runs it, args contains the script followed by its own arguments.
+// With -e, all of args are arguments of the snippet, a script named "-" is read from stdin.
+func RunCommand(args []string) {
+	var sources SourceMap
+	if *evalFlag != "" {
+		var snippetPath string
+		snippetPath, sources = WriteSnippet([]byte(*evalFlag), "-e")
+		args = append([]string{snippetPath}, args...)
 	}
-	if *completeBuildFlag {
-		config.CompleteBuild = true
-	}
-	if *recursiveReloadFlag {
-		config.HotReloadRecursive = true
-		*reloadFlag = true // Recursive HotReload enables HotReload
+	if len(args) == 0 {
+		usage()
 	}
-	if *reloadFlag {
-		config.HotReload = true
-		config.ForceCompile = true // HotReload enables ForceCompile
+	if args[0] == "-" {
+		code, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatalf("Could not read from stdin: %s", err)
+		}
+		args[0], sources = WriteSnippet(code, "<stdin>")
 	}
 
-	// Binary paths
-	var binaryDir string
-	if strings.HasPrefix(config.GoplayDirectory, string(os.PathSeparator)) {
-		// Handle absolute goplay directories different from relative ones
-		subdir := strings.Replace(scriptPath, string(os.PathSeparator), "_", -1)
-		binaryDir = filepath.Join(config.GoplayDirectory, subdir, filepath.Base(build.ToolDir))
-	} else {
-		// Relative goplay directory
-		binaryDir = filepath.Join(scriptDir, config.GoplayDirectory, filepath.Base(build.ToolDir))
+	// Script paths
+	scriptPath, err := filepath.Abs(args[0])
+	if err != nil {
+		log.Fatal(err)
 	}
-	binaryPath := filepath.Join(binaryDir, strings.Replace(scriptName, filepath.Ext(scriptName), "", 1))
+	scriptArgs := args[1:]
 
-	// Windows does not like running binaries without the ".exe" extension
-	if runtime.GOOS == "windows" {
-		binaryPath += ".exe"
+	ReadConfiguration(filepath.Dir(scriptPath))
+
+	ApplyFlags()
+	if *eventsFlag != "" {
+		if events, err = NewEventStream(*eventsFlag); err != nil {
+			log.Fatalf("Could not setup event stream: %s", err)
+		}
 	}
 
-	// Check directory
-	if !Exist(binaryDir) {
-		if err := os.MkdirAll(binaryDir, 0750); err != nil {
-			log.Fatalf("Could not make directory: %s", err)
+	// Binary paths
+	options := ScriptBuildOptions(scriptPath, sources)
+	binaryPath := BinaryPath(scriptPath, options)
+	binaryDir := filepath.Dir(binaryPath)
+	Verbosef("binary path [%s]", binaryPath)
+
+	// Check directory, nobody else may be able to plant binaries in it
+	if !*dryRunFlag {
+		if err := PrepareCacheDirectory(scriptPath, binaryDir); err != nil {
+			log.Fatalf("Unsafe cache directory: %s", err)
 		}
 	}
 
 	// Check if compilation is needed
 	compileNeeded := false
+	reason := ""
 	if !config.ForceCompile && Exist(binaryPath) { // Only check for existing binary if forceCompile is false
-		if GetTime(scriptPath).After(GetTime(binaryPath)) {
+		files := append([]string{scriptPath}, options.Includes...)
+		if config.CompleteBuild || options.Package != "" {
+			files = append(files, PackageSources(scriptPath, options)...)
+		}
+		scriptTime, binaryTime := LatestTime(files), GetTime(binaryPath)
+		if scriptTime.After(binaryTime) {
 			compileNeeded = true
+			reason = "script modified"
 		}
+		Verbosef("script modified at [%s], binary built at [%s]", scriptTime.Format(time.RFC3339Nano), binaryTime.Format(time.RFC3339Nano))
 	} else {
 		compileNeeded = true
+		reason = "forced"
+		if !Exist(binaryPath) {
+			reason = "no binary"
+		}
 	}
 
 	// Compilation needed?
 	if compileNeeded {
-		CompileBinary(scriptPath, binaryPath, config.CompleteBuild)
+		Verbosef("cache miss (%s), compiling [%s]", reason, scriptPath)
+		events.Emit(Event{Type: EventCache, Script: scriptPath, Binary: binaryPath, Cache: "miss", Reason: reason})
+		CompileBinary(scriptPath, binaryPath, config.CompleteBuild, options)
+	} else {
+		Verbosef("cache hit, binary is up to date")
+		events.Emit(Event{Type: EventCache, Script: scriptPath, Binary: binaryPath, Cache: "hit"})
+	}
+
+	if *dryRunFlag {
+		Verbosef("would run: %s", strings.Join(BinaryCommand(scriptPath, binaryPath, scriptArgs).Args, " "))
+		return
+	}
+	if err := CheckPrivateFile(binaryPath); err != nil {
+		log.Fatalf("Refusing to run cached binary: %s", err)
+	}
+	RunWatchAndExit(scriptPath, binaryPath, scriptArgs, options)
+}
+
+// ParseFlags parses the global options, "-h" exits with 0 and invalid options with 1
+func ParseFlags(flags *flag.FlagSet, args []string) {
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(1)
+	}
+	if *dryRunFlag {
+		*verboseFlag = true // Dry run enables verbose output
+	}
+	if *debugListenFlag != "" {
+		*debugFlag = true // Headless debugging enables debugging
+	}
+	if *debugFlag && *sandboxFlag {
+		log.Fatal("-debug can't be combined with -sandbox, which denies ptrace")
+	}
+}
+
+// CacheDirectory returns the directory containing the compiled binaries of the script
+func CacheDirectory(scriptPath string) string {
+	if IsSharedGoplayDirectory() {
+		// Handle absolute goplay directories different from relative ones
+		subdir := strings.Replace(scriptPath, string(os.PathSeparator), "_", -1)
+		return filepath.Join(CacheRoot(scriptPath), subdir, filepath.Base(build.ToolDir))
+	}
+	// Relative goplay directory
+	return filepath.Join(CacheRoot(scriptPath), filepath.Base(build.ToolDir))
+}
+
+// BinaryPath returns the path of the compiled binary of the script
+func BinaryPath(scriptPath string, options BuildOptions) string {
+	binaryDir := CacheDirectory(scriptPath)
+	// Binaries built with different build flags get their own directory, so they don't overwrite each other
+	if key := options.CacheKey(); key != "" {
+		binaryDir = filepath.Join(binaryDir, "flags-"+key)
+	}
+	// Scripts without ".go" extension get a ".bin" suffix, so "deploy" and "deploy.go" in the same directory don't share a binary
+	scriptName := filepath.Base(scriptPath)
+	if !strings.HasSuffix(scriptName, ".go") {
+		scriptName += ".bin"
 	}
+	// Windows does not like running binaries without the ".exe" extension
+	return filepath.Join(binaryDir, BinaryName(scriptName, runtime.GOOS))
+}
 
-	RunWatchAndExit(scriptPath, binaryPath)
+// ReadConfiguration reads /etc/goplayrc, ~/.goplayrc, all .goplayrc files from the project root down to $GO_SOURCE_FILE_DIR,
+// and the file given by -config or $GOPLAYRC, and overwrites values if found in configuration file.
+// With RequireSignature, it exits if a local .goplayrc is not signed.
+func ReadConfiguration(scriptDir string) {
+	readConfiguration(scriptDir, false)
 }
 
-func CompileBinary(scriptPath string, binaryPath string, goBuild bool) {
+// ReadConfigurationSkipUnsigned reads the configuration like ReadConfiguration, but skips unsigned local .goplayrc files with a warning
+func ReadConfigurationSkipUnsigned(scriptDir string) {
+	readConfiguration(scriptDir, true)
+}
+
+func readConfiguration(scriptDir string, skipUnsigned bool) {
+	// -no-config keeps runs reproducible, regardless of the machine they run on
+	if !*noConfigFlag {
+		ReadConfigurationFile(systemGoplayRc, &config)
+		ReadConfigurationFile(userGoplayRc, &config)
+	}
+	explicitGoplayRc := *configFlag
+	if explicitGoplayRc == "" {
+		explicitGoplayRc = os.Getenv("GOPLAYRC")
+	}
+	// This allows each project and script(directory) to have a local .goplayrc that takes precedence over the other 2 configuration files.
+	// Local files belong to the scripts project, with RequireSignature they are only read from their verified contents.
+	required := SignaturesRequired(explicitGoplayRc)
+	for _, filename := range LocalConfigurationFiles(scriptDir) {
+		if !required && !config.RequireSignature {
+			ReadConfigurationFile(filename, &config)
+			continue
+		}
+		verified, err := VerifySignatures(filename)
+		if err != nil && skipUnsigned {
+			messageLog.Printf("warning: skipping configuration file: %s", err)
+			continue
+		} else if err != nil {
+			log.Fatalf("Refusing to run: %s", err)
+		}
+		content, _ := SplitSignature(verified[filename])
+		Verbosef("reading configuration file [%s]", filename)
+		ApplyConfiguration(filename, content, &config)
+	}
+	// An explicitly selected configuration file has to exist
+	if explicitGoplayRc != "" && !ReadConfigurationFile(explicitGoplayRc, &config) {
+		log.Fatalf("Configuration file [%s] does not exist", explicitGoplayRc)
+	}
+	// Environment variables take precedence over all configuration files, but not over commandline flags
+	ReadEnvironment(&config)
+}
+
+// ApplyFlags overwrites the configuration with the commandline flags, which take precedence over configuration file values
+func ApplyFlags() {
+	if *forceCompileFlag {
+		config.ForceCompile = true
+		configSources["forcecompile"] = "flag -f"
+	}
+	if *completeBuildFlag {
+		config.CompleteBuild = true
+		configSources["completebuild"] = "flag -b"
+	}
+	if *recursiveReloadFlag {
+		config.HotReloadRecursive = true
+		configSources["hotreloadrecursive"] = "flag -R"
+		*reloadFlag = true // Recursive HotReload enables HotReload
+	}
+	if *fixFlag {
+		config.AutoImports = true  // -fix enables AutoImports
+		config.ForceCompile = true // An up to date binary would skip fixing the script
+		configSources["autoimports"] = "flag -fix"
+		configSources["forcecompile"] = "flag -fix"
+	}
+	if *reloadFlag {
+		config.HotReload = true
+		config.ForceCompile = true // HotReload enables ForceCompile
+		configSources["hotreload"] = "flag -r"
+		configSources["forcecompile"] = "flag -r"
+	}
+}
+
+// CompileBinary compiles the script into binaryPath with "go build", on the whole script directory if goBuild is true
+func CompileBinary(scriptPath string, binaryPath string, goBuild bool, options BuildOptions) {
 	scriptDir := filepath.Dir(scriptPath)
 	binaryDir := filepath.Dir(binaryPath)
 
+	start := time.Now()
+	events.Emit(Event{Type: EventBuildStart, Script: scriptPath, Binary: binaryPath})
+
+	// Signed files are compiled from private copies of their verified contents, which can't be changed after the verification
+	openPath := scriptPath
+	if options.Verified != nil && !*dryRunFlag {
+		var copies []string
+		openPath, copies = WriteVerifiedCopies(scriptPath, binaryDir, &options)
+		defer func() {
+			for _, copyPath := range copies {
+				os.Remove(copyPath)
+			}
+		}()
+	}
+
 	// Open source file for modifications
-	file, err := os.OpenFile(scriptPath, os.O_RDWR, 0)
+	file, err := os.OpenFile(openPath, os.O_RDWR, 0)
 	if err != nil {
 		log.Fatalf("Could not open file: %s", err)
 	}
@@ -190,8 +513,8 @@ func CompileBinary(scriptPath string, binaryPath string, goBuild bool) {
 		}
 	}()
 
-	// Comment hashbang line in source file
-	hasHashbang := CheckForHashbang(file)
+	// Comment hashbang line in source file, but leave the file alone on a dry run
+	hasHashbang := CheckForHashbang(file) && !*dryRunFlag
 	if hasHashbang {
 		CommentHashbang(file, "//")
 	}
@@ -201,66 +524,104 @@ func CompileBinary(scriptPath string, binaryPath string, goBuild bool) {
 			CommentHashbang(file, "#!")
 		}
 		// Recover build panic and use it for log.Fatal after hashbang has been restored
-		if r := recover(); r != nil {
+		r := recover()
+		buildEnd := Event{Type: EventBuildEnd, Script: scriptPath, Binary: binaryPath,
+			Success: boolPtr(r == nil), DurationMs: int64Ptr(time.Since(start).Nanoseconds() / int64(time.Millisecond))}
+		if r != nil {
+			buildEnd.Diagnostics = strings.Split(strings.TrimRight(fmt.Sprint(r), "\n"), "\n")
+		}
+		events.Emit(buildEnd)
+
+		if r != nil {
+			// Compiler errors are printed as they are, so that editors can jump to their positions
+			if buildErr, ok := r.(*BuildError); ok {
+				fmt.Fprint(os.Stderr, buildErr.Output)
+				os.Exit(1)
+			}
 			log.Fatal(r)
 		}
 	}()
 
-	// Use "go build"
-	if goBuild {
-		// Get current directory
-		currentDir, err := os.Getwd()
-		if err != nil {
-			panic(err)
+	// Wrap scripts without package clause and fix imports on a copy of the script, the script itself is only changed with -fix
+	sourcePath := openPath
+	if !*dryRunFlag {
+		if sourcePath = PrepareSource(file, scriptPath, binaryDir, &options); sourcePath != openPath {
+			defer os.Remove(sourcePath)
 		}
-		currentDir, err = filepath.Abs(currentDir)
-		if err != nil {
-			panic(err)
-		}
-		if currentDir != scriptDir {
-			// Change into scripts directory
-			if err := os.Chdir(scriptDir); err != nil {
-				panic(err)
+	}
+
+	// Offline builds fail early, listing all missing packages at once
+	if options.Offline != "" && !*dryRunFlag {
+		CheckOffline(scriptPath, append([]string{sourcePath}, options.Includes...), goBuild, options)
+	}
+
+	// Use "go build" on the scripts package
+	if goBuild || options.Package != "" {
+		// Build the scripts package inside its module or workspace, with the fixed copy of the script replacing the script itself
+		buildDir, target := BuildTarget(scriptPath, options.Package)
+		args := append([]string{"build", "-o", binaryPath}, options.GoBuildArgs()...)
+		overlay := PackageIncludes(scriptDir, &options)
+		if sourcePath != scriptPath {
+			// "go build" skips files without ".go" extension, so their copy is added to the package instead
+			replaced := scriptPath
+			if !strings.HasSuffix(scriptPath, ".go") {
+				replaced = filepath.Join(scriptDir, filepath.Base(sourcePath))
+				options.Sources[replaced] = options.Sources[sourcePath]
 			}
-			defer func() {
-				// Go back to previous directory
-				if err := os.Chdir(currentDir); err != nil {
-					panic(err)
-				}
-			}()
+			overlay[replaced] = sourcePath
 		}
-
-		// Build current/scripts directory
-		out, err := exec.Command("go", "build", "-o", binaryPath).CombinedOutput()
+		if len(overlay) > 0 {
+			overlayPath := WriteOverlay(binaryDir, overlay)
+			defer os.Remove(overlayPath)
+			args = append(args, "-overlay", overlayPath)
+		}
+		Verbosef("cd %s", buildDir)
+		cmd := exec.Command(options.Go(), append(args, target)...)
+		cmd.Dir = buildDir
+		cmd.Env = options.Env()
+		out, err := RunBuildCommand(cmd)
 		if err != nil {
-			panic(fmt.Errorf("%s\n%s\n", err, out))
+			panic(&BuildError{MapBuildOutput(out, buildDir, options.Sources)})
 		}
 
 	} else {
-		// Set toolchain
-		archChar, err := build.ArchChar(runtime.GOARCH)
-		if err != nil {
-			panic(err)
-		}
+		BuildFiles(append([]string{sourcePath}, options.Includes...), binaryPath, scriptDir, options)
+	}
+}
 
-		// Compile source file
-		objectPath := filepath.Join(binaryDir, "_go_."+archChar)
-		cmd := exec.Command(filepath.Join(build.ToolDir, archChar+"g"), "-o", objectPath, scriptPath)
-		out, err := cmd.CombinedOutput()
-		if err != nil {
-			panic(fmt.Errorf("%s\n%s", cmd.Args, out))
-		}
+// BuildFiles builds the source files into binaryPath with "go build", run inside dir. Build problems are panicked.
+func BuildFiles(files []string, binaryPath string, dir string, options BuildOptions) {
+	bundle := BundleFiles(files, filepath.Dir(binaryPath), &options)
+	if bundle[0] != files[0] {
+		defer func() {
+			for _, file := range bundle {
+				os.Remove(file)
+			}
+		}()
+	}
+	cmd := exec.Command(options.Go(), append(append([]string{"build", "-o", binaryPath}, options.GoBuildArgs()...), bundle...)...)
+	cmd.Dir = dir
+	cmd.Env = options.Env()
+	out, err := RunBuildCommand(cmd)
+	if err != nil {
+		panic(&BuildError{MapBuildOutput(out, dir, options.Sources)})
+	}
+}
 
-		// Link executable
-		out, err = exec.Command(filepath.Join(build.ToolDir, archChar+"l"), "-o", binaryPath, objectPath).CombinedOutput()
-		if err != nil {
-			panic(fmt.Errorf("Linker failed: %s\n%s", err, out))
-		}
+// RunBuildCommand runs a build command and returns its combined output.
+// The command is only printed on a dry run.
+func RunBuildCommand(cmd *exec.Cmd) ([]byte, error) {
+	Verbosef("%s", strings.Join(cmd.Args, " "))
+	if *dryRunFlag {
+		return nil, nil
+	}
+	return cmd.CombinedOutput()
+}
 
-		// Cleaning
-		if err := os.Remove(objectPath); err != nil {
-			panic(fmt.Errorf("Could not remove object file: %s", err))
-		}
+// Verbosef prints to stderr if verbose output is enabled
+func Verbosef(format string, args ...interface{}) {
+	if *verboseFlag {
+		messageLog.Printf(format, args...)
 	}
 }
 
@@ -320,12 +681,16 @@ func GetSubdirectories(startPath string) (paths []string) {
 }
 
 // RunWatchAndExit sets up a file watcher for hot-reload if needed, executes the binary and exits with it's exitcode
-func RunWatchAndExit(scriptPath string, binaryPath string) {
+func RunWatchAndExit(scriptPath string, binaryPath string, args []string, options BuildOptions) {
 	var err error
 	var cmd *exec.Cmd
 	restart := false
 
 	if config.HotReload {
+		included := make(map[string]bool)
+		for _, include := range options.Includes {
+			included[include] = true
+		}
 		watcher, err := fsnotify.NewWatcher()
 		if err != nil {
 			log.Fatal(err)
@@ -343,7 +708,9 @@ func RunWatchAndExit(scriptPath string, binaryPath string) {
 							fileExtension = fileExtension[1:]
 						}
 						if fileName == filepath.Base(scriptPath) || // Either match the script file itself
+							included[filepath.Clean(event.Name)] || // or one of the included files
 							config.HotReloadWatchExtensions.Contains(fileExtension) { // or if it has one of the defined extensions to watch
+							events.Emit(Event{Type: EventFileChange, Script: scriptPath, File: event.Name})
 							restart = true
 							cmd.Process.Kill()
 						}
@@ -363,6 +730,22 @@ func RunWatchAndExit(scriptPath string, binaryPath string) {
 		}
 		defer watcher.Close()
 
+		// The package built instead of the scripts directory is watched as well
+		if options.Package != "" {
+			if packageDir := PackageDirectory(BuildTarget(scriptPath, options.Package)); packageDir != "" && Exist(packageDir) {
+				if err := watcher.Watch(packageDir); err != nil {
+					log.Fatal(err)
+				}
+			}
+		}
+
+		// Included files are always watched
+		for _, include := range options.Includes {
+			if err := watcher.Watch(include); err != nil {
+				log.Fatal(err)
+			}
+		}
+
 		// Also watch subdirectories and files if in recursive mode
 		if config.HotReloadRecursive {
 			subdirs := GetSubdirectories(scriptPath)
@@ -374,13 +757,17 @@ func RunWatchAndExit(scriptPath string, binaryPath string) {
 		}
 	}
 
-	cmd = StartBinary(binaryPath, flag.Args()[1:])
+	cmd = StartBinary(scriptPath, binaryPath, args)
 	for {
 		err = cmd.Wait()
+		events.Emit(Event{Type: EventProcessExit, Binary: binaryPath, Pid: cmd.Process.Pid, ExitCode: intPtr(ExitCode(err))})
 		// Recompile and restart, if file watcher set restart flag to true
 		if restart {
-			CompileBinary(scriptPath, binaryPath, config.CompleteBuild)
-			cmd = StartBinary(binaryPath, flag.Args()[1:])
+			if options.Sources == nil {
+				options.Verified = RequireSignatures(append([]string{scriptPath}, options.Includes...)...)
+			}
+			CompileBinary(scriptPath, binaryPath, config.CompleteBuild, options)
+			cmd = StartBinary(scriptPath, binaryPath, args)
 			time.Sleep(333 * time.Millisecond)
 			restart = false
 		} else {
@@ -389,15 +776,42 @@ func RunWatchAndExit(scriptPath string, binaryPath string) {
 	}
 
 	// Returns the exitcode
-	if msg, ok := err.(*exec.ExitError); ok { // There is an error code
-		os.Exit(msg.Sys().(syscall.WaitStatus).ExitStatus())
+	if _, ok := err.(*exec.ExitError); ok { // There is an error code
+		os.Exit(ExitCode(err))
 	}
 }
 
-// Starts the binary file, passing additional commandline parameters along
-func StartBinary(binaryPath string, args []string) *exec.Cmd {
+// ExitCode returns the exitcode of a finished binary, given the error returned by cmd.Wait
+func ExitCode(err error) int {
+	if msg, ok := err.(*exec.ExitError); ok {
+		return msg.Sys().(syscall.WaitStatus).ExitStatus()
+	}
+	if err != nil {
+		return -1
+	}
+	return 0
+}
+
+// BinaryCommand returns the command for running the binary, which is wrapped by the debugger in debug mode and by the sandbox with -sandbox
+func BinaryCommand(scriptPath string, binaryPath string, args []string) *exec.Cmd {
 	cmd := exec.Command(binaryPath, args...)
-	cmd.Env = os.Environ()
+	if *debugFlag {
+		messageLog.Printf("debugging [%s]", binaryPath)
+		cmd = DebuggerCommand(binaryPath, args, *debugListenFlag)
+	}
+	if *sandboxFlag {
+		Verbosef("sandboxing [%s]", binaryPath)
+		cmd = SandboxCommand(cmd, NewSandboxOptions(scriptPath))
+	}
+	return cmd
+}
+
+// Starts the binary file, passing additional commandline parameters along
+func StartBinary(scriptPath string, binaryPath string, args []string) *exec.Cmd {
+	cmd := BinaryCommand(scriptPath, binaryPath, args)
+	if cmd.Env == nil {
+		cmd.Env = os.Environ() // The sandbox passes only its allowlist
+	}
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -405,6 +819,7 @@ func StartBinary(binaryPath string, args []string) *exec.Cmd {
 	if err := cmd.Start(); err != nil {
 		log.Fatalf("Could not execute: %q\n%s", cmd.Args, err)
 	}
+	events.Emit(Event{Type: EventProcessStart, Binary: binaryPath, Pid: cmd.Process.Pid})
 
 	return cmd
 }
@@ -14,6 +14,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -173,6 +174,13 @@ func TestGetSubdirectories(t *testing.T) {
 	}
 }
 
+func TestBinaryPath(t *testing.T) {
+	binaryDir := CacheDirectory("/scripts/deploy.go")
+	expected(t, "BinaryPath", BinaryPath("/scripts/deploy.go", BuildOptions{}), filepath.Join(binaryDir, BinaryName("deploy", runtime.GOOS)))
+	expected(t, "BinaryPath", BinaryPath("/scripts/deploy", BuildOptions{}), filepath.Join(binaryDir, BinaryName("deploy.bin", runtime.GOOS)))
+	expected(t, "BinaryPath", BinaryPath("/scripts/my.tool.go", BuildOptions{}), filepath.Join(binaryDir, BinaryName("my.tool", runtime.GOOS)))
+}
+
 func TestCompileBinary(t *testing.T) {
 	scriptFilename := "output.go"
 	binaryFilename := "TestCompileBinary_output"
@@ -189,7 +197,7 @@ func TestCompileBinary(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	CompileBinary(scriptPath, binaryPath, false)
+	CompileBinary(scriptPath, binaryPath, false, BuildOptions{})
 
 	if !Exist(binaryFilename) {
 		t.Fatalf("Compiled binary does not exist: [%s]", binaryFilename)
@@ -225,7 +233,7 @@ func TestCompleteBuild(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	CompileBinary(scriptPath, binaryPath, true)
+	CompileBinary(scriptPath, binaryPath, true, BuildOptions{})
 
 	if !Exist(binaryFilename) {
 		t.Fatalf("Compiled binary does not exist: [%s]", binaryFilename)
@@ -245,7 +253,7 @@ func TestStartBinary(t *testing.T) {
 		removeFile(t, filename)
 	}
 
-	cmd := StartBinary("goplay", []string{"write.go", filename})
+	cmd := StartBinary("write.go", "goplay", []string{"write.go", filename})
 	if err := cmd.Wait(); err != nil {
 		t.Fatal(err)
 	}
@@ -266,6 +274,49 @@ func TestNoExtension(t *testing.T) {
 	expected(t, "no_extension", string(out), "I'm extensionless")
 }
 
+func TestInclude(t *testing.T) {
+	out, err := exec.Command("./include/include.go").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "include.go", string(out), "Hello from include")
+}
+
+func TestIncludeGoBuild(t *testing.T) {
+	// Included files from other directories are bundled for "go build", which has to accept the copies
+	out, err := exec.Command("goplay", "-tags", "goplay", "include/include.go").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "include.go", string(out), "Hello from include")
+}
+
+func TestIncludeCompleteBuild(t *testing.T) {
+	// Complete builds only compile the scripts directory, included files of other directories are added through the overlay
+	out, err := exec.Command("goplay", "-b", "include/include.go").CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	expected(t, "include.go", string(out), "Hello from include")
+}
+
+func TestScriptMode(t *testing.T) {
+	out, err := exec.Command("./script_mode", "goplay").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "script_mode", string(out), "Hello from goplay")
+}
+
+func TestScriptModeGoBuild(t *testing.T) {
+	// "go build" has to accept the generated copy of the script, also together with build flags
+	out, err := exec.Command("goplay", "-tags", "goplay", "script_mode", "go build").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "script_mode", string(out), "Hello from go build")
+}
+
 func TestInput(t *testing.T) {
 	var buffer bytes.Buffer
 	cmd := exec.Command("./input.go")
@@ -346,3 +397,64 @@ func TestHotReloadRecursiveAndFileExtensions(t *testing.T) {
 
 	expected(t, "watch/watch.go", buffer.String(), "Start!\nStart!\nStart!\nStop!\n")
 }
+
+func TestDryRun(t *testing.T) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("goplay", "-n", "-f", "write.go", "TestDryRun.test")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "write.go", string(out), "")
+
+	if Exist("TestDryRun.test") {
+		removeFile(t, "TestDryRun.test")
+		t.Error("Script should not have been executed on a dry run")
+	}
+	if !strings.Contains(stderr.String(), "cache miss (forced)") {
+		t.Errorf("Dry run should explain the cache decision, but got [%s]", stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "would run: ") {
+		t.Errorf("Dry run should print the command to run, but got [%s]", stderr.String())
+	}
+}
+
+func TestSubcommandsAndLongOptions(t *testing.T) {
+	// "--" ends the options, everything after FILE is passed along to the script
+	out, err := exec.Command("goplay", "--force", "run", "--", "parameters.go", "-f", "--", "--force").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "parameters.go", string(out), "Parameters: 3\n-f\n--\n--force\n")
+
+	// Help is not an error
+	if err := exec.Command("goplay", "-h").Run(); err != nil {
+		t.Errorf("goplay -h should exit with 0, but got [%s]", err)
+	}
+	if err := exec.Command("goplay", "--unknown", "output.go").Run(); err == nil {
+		t.Error("goplay --unknown should fail")
+	}
+}
+
+func TestCacheCommand(t *testing.T) {
+	if out, err := exec.Command("goplay", "-f", "output.go").Output(); err != nil {
+		t.Fatalf("%s\n%s", err, out)
+	}
+
+	out, err := exec.Command("goplay", "cache", "dir", "output.go").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheDir := strings.TrimSpace(string(out))
+	if !Exist(filepath.Join(cacheDir, "output")) {
+		t.Fatalf("Cached binary does not exist in [%s]", cacheDir)
+	}
+
+	if err := exec.Command("goplay", "cache", "clean", "output.go").Run(); err != nil {
+		t.Fatal(err)
+	}
+	if Exist(filepath.Join(cacheDir, "output")) {
+		t.Errorf("Cached binary should have been removed from [%s]", cacheDir)
+	}
+}
@@ -0,0 +1,145 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ResolveIncludes returns the absolute paths of all files matching the space separated patterns, sorted and without duplicates.
+// Relative patterns are resolved against dir, patterns without wildcards must match an existing file.
+func ResolveIncludes(dir string, patterns []string, exclude string) ([]string, error) {
+	found := make(map[string]bool)
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern [%s]: %s", pattern, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return nil, fmt.Errorf("included file [%s] does not exist", pattern)
+		}
+		for _, match := range matches {
+			if match != exclude && !strings.HasSuffix(match, "_test.go") {
+				found[match] = true
+			}
+		}
+	}
+
+	var includes []string
+	for include := range found {
+		includes = append(includes, include)
+	}
+	sort.Strings(includes)
+	return includes, nil
+}
+
+// ScriptIncludes returns all files compiled together with the script, from its //goplay:include directives and the -include flag
+func (o BuildOptions) ScriptIncludes(scriptPath string) []string {
+	var patterns []string
+	for _, directive := range o.Directives(scriptPath, "include") {
+		patterns = append(patterns, strings.Fields(directive)...)
+	}
+	for _, pattern := range strings.Fields(*includeFlag) {
+		if absPattern, err := filepath.Abs(pattern); err == nil {
+			pattern = absPattern
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	includes, err := ResolveIncludes(filepath.Dir(scriptPath), patterns, scriptPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, include := range includes {
+		Verbosef("including [%s]", include)
+	}
+	return includes
+}
+
+// LatestTime returns the latest modification time of all files
+func LatestTime(files []string) (latest time.Time) {
+	for _, file := range files {
+		if modTime := GetTime(file); modTime.After(latest) {
+			latest = modTime
+		}
+	}
+	return latest
+}
+
+// PackageIncludes returns the overlay adding the included files to the scripts package for complete builds, which only compile the scripts directory.
+// Included files inside the scripts directory are part of the package anyway. The added files are mapped back to the included files in the source map of the options.
+func PackageIncludes(scriptDir string, options *BuildOptions) map[string]string {
+	overlay := make(map[string]string)
+	if len(options.Includes) == 0 {
+		return overlay
+	}
+	sources := SourceMap{}
+	for path, original := range options.Sources {
+		sources[path] = original
+	}
+	for i, include := range options.Includes {
+		name := filepath.Base(include)
+		if filepath.Dir(include) == scriptDir && strings.HasSuffix(name, ".go") && !strings.HasPrefix(name, "_") && !strings.HasPrefix(name, ".") {
+			continue
+		}
+		added := filepath.Join(scriptDir, fmt.Sprintf("goplay_include_%d_%s", i, name))
+		overlay[added] = include
+		if source, found := options.Sources[include]; found {
+			sources[added] = source
+		} else {
+			sources[added] = Source{include, 0}
+		}
+	}
+	options.Sources = sources
+	return overlay
+}
+
+// BundleFiles returns the files to hand to "go build", which insists on all named files being in the same directory.
+// If they are not, all files are copied into binaryDir, and the copies are added to the source map of the options.
+// Like all generated files, the copies don't start with "_", which "go build" would ignore.
+func BundleFiles(files []string, binaryDir string, options *BuildOptions) []string {
+	sameDir := true
+	for _, file := range files {
+		sameDir = sameDir && filepath.Dir(file) == filepath.Dir(files[0])
+	}
+	if sameDir {
+		return files
+	}
+
+	sources := SourceMap{}
+	for path, original := range options.Sources {
+		sources[path] = original
+	}
+	var bundle []string
+	for i, file := range files {
+		copyPath := filepath.Join(binaryDir, fmt.Sprintf("goplay_bundle_%d_%s", i, filepath.Base(file)))
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		if err := ioutil.WriteFile(copyPath, data, 0600); err != nil {
+			panic(err)
+		}
+		if source, found := options.Sources[file]; found {
+			sources[copyPath] = source
+		} else {
+			sources[copyPath] = Source{file, 0}
+		}
+		bundle = append(bundle, copyPath)
+	}
+	options.Sources = sources
+	return bundle
+}
@@ -0,0 +1,97 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveIncludes(t *testing.T) {
+	dir, err := filepath.Abs("include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptPath := filepath.Join(dir, "include.go")
+
+	includes, err := ResolveIncludes(dir, []string{"lib/*.go", "lib/greeting.go", "*.go"}, scriptPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "ResolveIncludes", strings.Join(includes, ","), filepath.Join(dir, "lib", "greeting.go"))
+
+	// Patterns without matches are fine, missing files are not
+	if _, err := ResolveIncludes(dir, []string{"missing/*.go"}, scriptPath); err != nil {
+		t.Error(err)
+	}
+	if _, err := ResolveIncludes(dir, []string{"missing.go"}, scriptPath); err == nil {
+		t.Error("Missing included file should be an error")
+	}
+}
+
+func TestLatestTime(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	older, newer := filepath.Join(dir, "older.go"), filepath.Join(dir, "newer.go")
+	for _, file := range []string{older, newer} {
+		if err := ioutil.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	latest := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(newer, latest, latest); err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "LatestTime", LatestTime([]string{older, newer}).Equal(latest), true)
+}
+
+func TestBundleFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := []string{filepath.Join(dir, "script.go"), filepath.Join(dir, "helpers.go")}
+	var options BuildOptions
+	expected(t, "BundleFiles", strings.Join(BundleFiles(files, dir, &options), ","), strings.Join(files, ","))
+
+	if err := os.Mkdir(filepath.Join(dir, "lib"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, filepath.Join(dir, "lib", "helpers.go"))
+	for _, file := range files {
+		if err := ioutil.WriteFile(file, []byte("package main\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundle := BundleFiles(files, dir, &options)
+	expected(t, "BundleFiles", len(bundle), 3)
+	expected(t, "BundleFiles", bundle[2], filepath.Join(dir, "goplay_bundle_2_helpers.go"))
+	expected(t, "BundleFiles", options.Sources[bundle[2]], Source{filepath.Join(dir, "lib", "helpers.go"), 0})
+}
+
+func TestPackageIncludes(t *testing.T) {
+	dir, err := filepath.Abs("include")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := BuildOptions{Includes: []string{filepath.Join(dir, "helpers.go"), filepath.Join(dir, "lib", "greeting.go")}}
+	overlay := PackageIncludes(dir, &options)
+	added := filepath.Join(dir, "goplay_include_1_greeting.go")
+	expected(t, "PackageIncludes", len(overlay), 1)
+	expected(t, "PackageIncludes", overlay[added], filepath.Join(dir, "lib", "greeting.go"))
+	expected(t, "PackageIncludes", options.Sources[added], Source{filepath.Join(dir, "lib", "greeting.go"), 0})
+}
@@ -0,0 +1,142 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/build"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// FindUpwards returns the path of the first file with the given name in dir or one of its parent directories, or "" if there is none
+func FindUpwards(dir string, name string) string {
+	dir = filepath.Clean(dir)
+	for {
+		if filename := filepath.Join(dir, name); Exist(filename) {
+			return filename
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// FindWorkspace returns the go.work file used for building in dir, or "" if there is none.
+// Just like the go command, $GOWORK takes precedence and GOWORK=off disables workspaces.
+func FindWorkspace(dir string) string {
+	switch gowork := os.Getenv("GOWORK"); gowork {
+	case "off":
+		return ""
+	case "":
+		return FindUpwards(dir, "go.work")
+	default:
+		return gowork
+	}
+}
+
+// ScriptPackage returns the package to build instead of the scripts directory, from its //goplay:package directive
+func (o BuildOptions) ScriptPackage(scriptPath string) string {
+	packages := o.Directives(scriptPath, "package")
+	if len(packages) == 0 {
+		return ""
+	}
+	return packages[len(packages)-1]
+}
+
+// BuildTarget returns the directory to run "go build" in, and the package to build for the script in complete build mode.
+//
+// Inside a module, "go build" runs in the module root and builds the scripts directory as "./path/to/script",
+// or pkg if given. Outside of modules, but inside a workspace, it runs in the workspace root instead.
+// Relative packages are resolved against that root, like "./cmd/tool", and against the scripts directory if there is neither.
+func BuildTarget(scriptPath string, pkg string) (dir string, target string) {
+	scriptDir := filepath.Dir(scriptPath)
+
+	root := ""
+	if goMod := FindUpwards(scriptDir, "go.mod"); goMod != "" {
+		root = filepath.Dir(goMod)
+		Verbosef("module [%s]", goMod)
+	}
+	if goWork := FindWorkspace(scriptDir); goWork != "" {
+		if root == "" {
+			root = filepath.Dir(goWork)
+		}
+		Verbosef("workspace [%s]", goWork)
+	}
+	if root == "" {
+		root = scriptDir
+	}
+
+	if pkg != "" {
+		return root, pkg
+	}
+	rel, err := filepath.Rel(root, scriptDir)
+	if err != nil || rel == "." {
+		return root, "."
+	}
+	return root, "./" + filepath.ToSlash(rel)
+}
+
+// PackageDirectory returns the directory of a relative package target, or "" for import paths
+func PackageDirectory(dir string, target string) string {
+	if !build.IsLocalImport(filepath.ToSlash(target)) {
+		return ""
+	}
+	return filepath.Join(dir, target)
+}
+
+// PackageSources returns the source files of the package built for the script and of its dependencies inside the module or workspace,
+// whose changes make the binary stale. Packages of the standard library and of downloaded modules never change.
+func PackageSources(scriptPath string, options BuildOptions) (sources []string) {
+	buildDir, target := BuildTarget(scriptPath, options.Package)
+	args := append(append([]string{"list", "-e", "-deps", "-json"}, options.GoBuildArgs()...), target)
+	cmd := exec.Command(options.Go(), args...)
+	cmd.Dir = buildDir
+	cmd.Env = options.Env()
+	Verbosef("%s", strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return nil // Let the build report the problem
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(out))
+	for {
+		var pkg struct {
+			Dir                           string
+			Standard                      bool
+			GoFiles, CgoFiles, EmbedFiles []string
+			Module                        *struct {
+				Version string
+				Replace *struct{ Version string }
+			}
+		}
+		if err := decoder.Decode(&pkg); err == io.EOF {
+			return sources
+		} else if err != nil {
+			return nil
+		}
+		downloaded := false
+		if module := pkg.Module; module != nil {
+			// Modules replaced by local directories have no version
+			downloaded = module.Version != "" && (module.Replace == nil || module.Replace.Version != "")
+		}
+		if pkg.Standard || downloaded {
+			continue
+		}
+		for _, files := range [][]string{pkg.GoFiles, pkg.CgoFiles, pkg.EmbedFiles} {
+			for _, file := range files {
+				sources = append(sources, filepath.Join(pkg.Dir, file))
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gowork := os.Getenv("GOWORK")
+	defer os.Setenv("GOWORK", gowork)
+	os.Setenv("GOWORK", "")
+
+	for _, subdir := range []string{"workspace/module/scripts", "workspace/tools", "plain"} {
+		if err := os.MkdirAll(filepath.Join(dir, subdir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"workspace/go.work", "workspace/module/go.mod"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	module := filepath.Join(dir, "workspace", "module")
+
+	buildDir, target := BuildTarget(filepath.Join(module, "scripts", "run.go"), "")
+	expected(t, "BuildTarget", buildDir, module)
+	expected(t, "BuildTarget", target, "./scripts")
+
+	buildDir, target = BuildTarget(filepath.Join(module, "run.go"), "")
+	expected(t, "BuildTarget", buildDir, module)
+	expected(t, "BuildTarget", target, ".")
+
+	// Scripts elsewhere can build any package of their module
+	buildDir, target = BuildTarget(filepath.Join(module, "scripts", "run.go"), "./cmd/tool")
+	expected(t, "BuildTarget", buildDir, module)
+	expected(t, "BuildTarget", target, "./cmd/tool")
+
+	// Outside of modules, the workspace root is used
+	buildDir, target = BuildTarget(filepath.Join(dir, "workspace", "tools", "run.go"), "./module/cmd/tool")
+	expected(t, "BuildTarget", buildDir, filepath.Join(dir, "workspace"))
+	expected(t, "BuildTarget", target, "./module/cmd/tool")
+
+	os.Setenv("GOWORK", "off")
+	buildDir, target = BuildTarget(filepath.Join(dir, "workspace", "tools", "run.go"), "")
+	expected(t, "BuildTarget", buildDir, filepath.Join(dir, "workspace", "tools"))
+	expected(t, "BuildTarget", target, ".")
+	expected(t, "FindWorkspace", FindWorkspace(module), "")
+
+	os.Setenv("GOWORK", "/elsewhere/go.work")
+	expected(t, "FindWorkspace", FindWorkspace(module), "/elsewhere/go.work")
+}
+
+func TestPackageDirectory(t *testing.T) {
+	expected(t, "PackageDirectory", PackageDirectory("/src/module", "./cmd/tool"), filepath.Join("/src/module", "cmd", "tool"))
+	expected(t, "PackageDirectory", PackageDirectory("/src/module", "."), filepath.Join("/src/module"))
+	expected(t, "PackageDirectory", PackageDirectory("/src/module", "example.com/module/cmd/tool"), "")
+}
+
+func TestPackageSourcesRebuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"go.mod":            "module example.com/tool\n\ngo 1.21\n",
+		"cmd/tool/main.go":  "package main\n\nimport \"example.com/tool/greeting\"\n\nfunc main() {\n\tprint(greeting.Text)\n}\n",
+		"greeting/greet.go": "package greeting\n\nconst Text = \"first\"\n",
+		"run.go":            "//goplay:package ./cmd/tool\n\npackage main\n",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scriptPath := filepath.Join(dir, "run.go")
+
+	sources := PackageSources(scriptPath, BuildOptions{Package: "./cmd/tool"})
+	expected(t, "PackageSources", strings.Join(sources, ","), filepath.Join(dir, "greeting", "greet.go")+","+filepath.Join(dir, "cmd", "tool", "main.go"))
+
+	out, err := exec.Command("goplay", scriptPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	expected(t, "goplay", string(out), "first")
+
+	// Changing a dependency of the package makes the binary stale
+	greetPath := filepath.Join(dir, "greeting", "greet.go")
+	if err := ioutil.WriteFile(greetPath, []byte("package greeting\n\nconst Text = \"second\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(greetPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+	out, err = exec.Command("goplay", scriptPath).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	expected(t, "goplay", string(out), "second")
+}
@@ -0,0 +1,163 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// OfflineMode returns how the go command is kept offline for the script with the Offline configuration:
+// "vendor" if its module has a vendor directory, "proxy-off" otherwise, and "" if not offline at all
+func OfflineMode(scriptPath string) string {
+	if !config.Offline {
+		return ""
+	}
+	if goMod := FindUpwards(filepath.Dir(scriptPath), "go.mod"); goMod != "" && Exist(filepath.Join(filepath.Dir(goMod), "vendor")) {
+		return "vendor"
+	}
+	return "proxy-off"
+}
+
+// IsStandardImport returns true for packages of the standard library, whose first path element has no dot
+func IsStandardImport(path string) bool {
+	return !strings.Contains(strings.Split(path, "/")[0], ".")
+}
+
+// ScriptImports returns all imports of the files, without the standard library, sorted and without duplicates.
+// Scripts in script mode and with AutoImports are read with the imports goplay adds to them.
+func ScriptImports(files []string) (imports []string) {
+	found := make(map[string]bool)
+	for _, file := range files {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			log.Fatalf("Could not read file: %s", err)
+		}
+		if bytes.HasPrefix(src, []byte("#!")) {
+			src = append([]byte("//"), src[2:]...)
+		}
+		if IsScriptMode(src) {
+			src, _ = WrapSnippet(src, file)
+		} else if config.AutoImports {
+			src, _ = FixImports(file, src)
+		}
+
+		parsed, err := parser.ParseFile(token.NewFileSet(), file, src, parser.ImportsOnly)
+		if err != nil {
+			continue // The compiler reports the problem
+		}
+		for _, spec := range parsed.Imports {
+			if path, err := strconv.Unquote(spec.Path.Value); err == nil && path != "C" && !IsStandardImport(path) {
+				found[path] = true
+			}
+		}
+	}
+	for path := range found {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+// MissingPackages returns all packages, including their dependencies, which the go command of the options can't find inside dir
+func MissingPackages(dir string, packages []string, options BuildOptions) (missing []string) {
+	if len(packages) == 0 {
+		return nil
+	}
+	cmd := exec.Command(options.Go(), append([]string{"list", "-e", "-deps", "-f", "{{if .Error}}{{.ImportPath}}{{end}}"}, packages...)...)
+	cmd.Dir = dir
+	cmd.Env = options.Env()
+	Verbosef("%s", strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return nil // Let the build report the problem
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			missing = append(missing, line)
+		}
+	}
+	return missing
+}
+
+// CheckOffline makes sure everything the script needs is available offline, before compiling it.
+// All missing packages are reported at once, together with how to make them available.
+func CheckOffline(scriptPath string, files []string, goBuild bool, options BuildOptions) {
+	buildDir, target := BuildTarget(scriptPath, options.Package)
+	packages := []string{target}
+	if !goBuild && options.Package == "" {
+		packages = ScriptImports(files)
+	}
+
+	missing := MissingPackages(buildDir, packages, options)
+	if len(missing) == 0 {
+		return
+	}
+	hint := fmt.Sprintf("download them while online with \"goplay deps %s\"", scriptPath)
+	if options.Offline == "vendor" {
+		hint = fmt.Sprintf("vendor them while online with \"goplay deps -vendor %s\"", scriptPath)
+	}
+	panic(fmt.Errorf("Offline build of [%s] is missing packages:\n\t%s\n%s", scriptPath, strings.Join(missing, "\n\t"), hint))
+}
+
+// DepsCommand implements "goplay deps [-vendor] FILE", which downloads or vendors everything the script needs to build offline
+func DepsCommand(args []string) {
+	var options BuildOptions
+	flags := NewBuildFlagSet("deps", &options)
+	vendor := flags.Bool("vendor", false, "vendor dependencies")
+
+	files := ParseInterspersed(flags, args)
+	if len(files) != 1 {
+		usage()
+	}
+	scriptPath := ReadBuildConfiguration(files[0])
+	options.ReadScript(scriptPath)
+	options.Offline = "" // The network is needed right here
+
+	goMod := FindUpwards(filepath.Dir(scriptPath), "go.mod")
+	if goMod == "" {
+		log.Fatalf("Script [%s] is not inside a module, create one with \"go mod init\" to manage its dependencies", scriptPath)
+	}
+	moduleRoot := filepath.Dir(goMod)
+
+	packages := ScriptImports(append([]string{scriptPath}, options.Includes...))
+	if options.Package != "" {
+		packages = append(packages, options.Package)
+	}
+	if len(packages) > 0 {
+		RunDepsCommand(moduleRoot, options, append([]string{"get"}, packages...)...)
+	}
+	RunDepsCommand(moduleRoot, options, "mod", "download")
+	if *vendor || Exist(filepath.Join(moduleRoot, "vendor")) {
+		RunDepsCommand(moduleRoot, options, "mod", "vendor")
+	}
+	if !*dryRunFlag {
+		fmt.Printf("Dependencies of [%s] are available offline\n", scriptPath)
+	}
+}
+
+// RunDepsCommand runs the go command of the options inside dir, and exits if it fails
+func RunDepsCommand(dir string, options BuildOptions, args ...string) {
+	cmd := exec.Command(options.Go(), args...)
+	cmd.Dir = dir
+	cmd.Env = options.Env()
+	out, err := RunBuildCommand(cmd)
+	os.Stderr.Write(out)
+	if err != nil {
+		log.Fatalf("%q failed: %s", cmd.Args, err)
+	}
+}
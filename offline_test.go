@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsStandardImport(t *testing.T) {
+	expected(t, "IsStandardImport", IsStandardImport("net/http"), true)
+	expected(t, "IsStandardImport", IsStandardImport("golang.org/x/tools/imports"), false)
+	expected(t, "IsStandardImport", IsStandardImport("github.com/howeyc/fsnotify"), false)
+}
+
+func TestScriptImports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "script")
+	helpers := filepath.Join(dir, "helpers.go")
+	if err := ioutil.WriteFile(script, []byte("#!/usr/bin/env goplay\nimport \"example.com/b\"\nfmt.Println(b.Value)\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(helpers, []byte("package main\n\nimport (\n\t\"os\"\n\t\"example.com/a\"\n\t\"example.com/b\"\n)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "ScriptImports", strings.Join(ScriptImports([]string{script, helpers}), ","), "example.com/a,example.com/b")
+}
+
+func TestOfflineMode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	scriptPath := filepath.Join(dir, "script.go")
+
+	expected(t, "OfflineMode", OfflineMode(scriptPath), "")
+	config.Offline = true
+	defer func() { config.Offline = false }()
+	expected(t, "OfflineMode", OfflineMode(scriptPath), "proxy-off")
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/script\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "vendor"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "OfflineMode", OfflineMode(scriptPath), "vendor")
+
+	env := strings.Join(BuildOptions{Offline: "vendor"}.Env(), "\n")
+	if !strings.Contains(env, "\nGOPROXY=off") || !strings.Contains(env, "-mod=vendor") {
+		t.Errorf("Offline environment should disable the proxy and use the vendor directory")
+	}
+}
+
+func TestMissingPackages(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/script\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	options := BuildOptions{Offline: "proxy-off"}
+	missing := MissingPackages(dir, []string{"fmt", "example.com/missing/a", "example.com/missing/b"}, options)
+	expected(t, "MissingPackages", strings.Join(missing, ","), "example.com/missing/a,example.com/missing/b")
+	expected(t, "MissingPackages", len(MissingPackages(dir, []string{"fmt"}, options)), 0)
+}
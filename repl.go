@@ -0,0 +1,470 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/imports"
+)
+
+// Prompt shown in front of every line of an interactive session
+const REPL_PROMPT = "goplay> "
+
+// ReplRunner compiles and runs a generated program, returning its output.
+// Build problems are returned as *BuildError, so they can be told apart from failing programs.
+type ReplRunner func(src []byte) ([]byte, error)
+
+// Repl is an interactive session, every declaration or statement entered is added to a generated main program,
+// which is then compiled and run again. Only the output that is new compared to the previous run is shown.
+type Repl struct {
+	Imports []string // Import paths added with :import or import declarations
+	Decls   []string // Top level declarations, like func, type, const and var, starting with the line directive of their input
+	Stmts   []string // Statements of func main, starting with the line directive of their input
+	History []string // All lines entered, oldest first
+	pending []string // Lines of an incomplete declaration or statement, which continues on the next line
+	output  []byte   // Output of the last successful run
+	run     ReplRunner
+}
+
+// NewRepl returns an empty session, which runs its programs with run
+func NewRepl(run ReplRunner) *Repl {
+	return &Repl{run: run}
+}
+
+// Line directives in front of every input, the compiler reports positions in the lines of the history instead of the generated program
+var replDirectiveRx = regexp.MustCompile(`/\*line repl:\d+:\d+\*/`)
+
+// ReplDirective returns the line directive for an input, which starts at the given line of the history
+func ReplDirective(line int) string {
+	return fmt.Sprintf("/*line repl:%d:1*/", line)
+}
+
+// Source returns the generated program for the given declarations and statements, with its imports fixed and without line directives
+func (repl *Repl) Source(decls []string, stmts []string) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteString("package main\n\n")
+	if len(repl.Imports) > 0 {
+		buffer.WriteString("import (\n")
+		for _, path := range repl.Imports {
+			fmt.Fprintf(&buffer, "\t%q\n", path)
+		}
+		buffer.WriteString(")\n\n")
+	}
+	WriteReplBody(&buffer, decls, stmts)
+
+	src, err := imports.Process("repl.go", replDirectiveRx.ReplaceAll(buffer.Bytes(), nil), nil)
+	if err != nil {
+		// Let the compiler report the problem
+		return replDirectiveRx.ReplaceAll(buffer.Bytes(), nil)
+	}
+	return src
+}
+
+// Program returns the generated program as it is compiled, with the imports of Source and the declarations and statements as entered.
+// They are not formatted and keep their line directives, so that compiler positions point to the lines of the history.
+func (repl *Repl) Program(decls []string, stmts []string) []byte {
+	src := repl.Source(decls, stmts)
+	fileSet := token.NewFileSet()
+	header := "package main\n"
+	if file, err := parser.ParseFile(fileSet, "", src, parser.ImportsOnly); err == nil && len(file.Decls) > 0 {
+		header = string(src[:fileSet.Position(file.Decls[len(file.Decls)-1].End()).Offset]) + "\n"
+	}
+	buffer := bytes.NewBufferString(header + "\n")
+	WriteReplBody(buffer, decls, stmts)
+	return buffer.Bytes()
+}
+
+// WriteReplBody writes the declarations and func main with the statements
+func WriteReplBody(buffer *bytes.Buffer, decls []string, stmts []string) {
+	for _, decl := range decls {
+		fmt.Fprintf(buffer, "%s\n\n", decl)
+	}
+	buffer.WriteString("func main() {\n")
+	for _, stmt := range stmts {
+		fmt.Fprintf(buffer, "\t%s\n", stmt)
+	}
+	buffer.WriteString("}\n")
+}
+
+// Eval handles a single line of input, which is either a command like :import or Go code.
+// Go code continues on the following lines, until its declaration or statement is complete. It returns true if the session should end.
+func (repl *Repl) Eval(line string, writer io.Writer) bool {
+	if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, ":") {
+		repl.History = append(repl.History, trimmed)
+		return repl.Command(trimmed, writer)
+	} else if len(repl.pending) == 0 {
+		if trimmed == "" {
+			return false
+		}
+		line = trimmed
+	} else {
+		line = strings.TrimRight(line, " \t\r")
+	}
+	repl.History = append(repl.History, line)
+	repl.pending = append(repl.pending, line)
+	input := strings.Join(repl.pending, "\n")
+	if Incomplete(input) {
+		return false
+	}
+	at := ReplDirective(len(repl.History) - len(repl.pending) + 1)
+	repl.pending = nil
+
+	// Declarations are added in front of func main
+	if file, err := parser.ParseFile(token.NewFileSet(), "", "package main\n"+input, 0); err == nil {
+		var paths []string
+		for _, spec := range file.Imports {
+			path, _ := strconv.Unquote(spec.Path.Value)
+			paths = append(paths, path)
+		}
+		if len(file.Decls) == len(file.Imports) {
+			repl.AddImports(paths...)
+			return false
+		}
+		repl.AddImports(paths...)
+		repl.try(append(repl.Decls, at+input), repl.Stmts, writer, true)
+		return false
+	}
+
+	// Expressions are printed, calls may be statements as well
+	if expr, err := parser.ParseExpr(input); err == nil {
+		printed := append(repl.Stmts[:len(repl.Stmts):len(repl.Stmts)], fmt.Sprintf("fmt.Println(%s%s)", at, input))
+		if _, isCall := expr.(*ast.CallExpr); !isCall {
+			repl.try(repl.Decls, printed, writer, false)
+			return false
+		}
+		stmts := append(repl.Stmts, at+input)
+		if PrintsResults(repl.Source(repl.Decls, stmts)) {
+			repl.try(repl.Decls, printed, writer, false)
+			return false
+		}
+		repl.try(repl.Decls, stmts, writer, true)
+		return false
+	}
+
+	lines := StatementLines(input)
+	lines[0] = at + lines[0]
+	repl.try(repl.Decls, append(repl.Stmts, lines...), writer, true)
+	return false
+}
+
+// Incomplete returns true, if the input ends in the middle of a declaration or statement, like after the opening brace of a block.
+// That is the case, when it neither parses as declaration nor as statement, and the first problem is found after its end.
+func Incomplete(input string) bool {
+	incomplete := false
+	for _, wrapper := range [][2]string{{"package main\n", ""}, {"package main\nfunc main() {\n", "\n}"}} {
+		_, err := parser.ParseFile(token.NewFileSet(), "", wrapper[0]+input+wrapper[1], 0)
+		if err == nil {
+			return false
+		}
+		if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+			first := list[0]
+			incomplete = incomplete || first.Pos.Offset >= len(wrapper[0])+len(input) ||
+				first.Msg == "raw string literal not terminated" || first.Msg == "comment not terminated"
+		}
+	}
+	return incomplete
+}
+
+// PrintsResults returns true if the results of the call, which is the last statement of the programs func main, should be printed.
+// Calls without results, or with an error as last result like fmt.Println, are statements instead, which stay part of the session.
+func PrintsResults(src []byte) bool {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "repl.go", src, 0)
+	if err != nil {
+		return false
+	}
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	conf := types.Config{Importer: importer.Default(), Error: func(error) {}}
+	conf.Check("main", fileSet, []*ast.File{file}, info)
+
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" && len(fn.Body.List) > 0 {
+			stmt, ok := fn.Body.List[len(fn.Body.List)-1].(*ast.ExprStmt)
+			if !ok {
+				return false
+			}
+			switch t := info.TypeOf(stmt.X).(type) {
+			case nil:
+				return false
+			case *types.Tuple:
+				return t.Len() > 0 && t.At(t.Len()-1).Type().String() != "error"
+			default:
+				return t.String() != "error"
+			}
+		}
+	}
+	return false
+}
+
+// try runs the program with the given declarations and statements and reports the result
+func (repl *Repl) try(decls []string, stmts []string, writer io.Writer, keep bool) bool {
+	out, err := repl.run(repl.Program(decls, stmts))
+	return repl.report(decls, stmts, out, err, writer, keep)
+}
+
+// report prints the new output of a run and its problems to writer.
+// If keep is set and the run was successful, the declarations and statements become part of the session.
+func (repl *Repl) report(decls []string, stmts []string, out []byte, err error, writer io.Writer, keep bool) bool {
+	if bytes.HasPrefix(out, repl.output) {
+		writer.Write(out[len(repl.output):])
+	} else {
+		writer.Write(out)
+	}
+	if err != nil {
+		if _, isBuildErr := err.(*BuildError); !isBuildErr {
+			fmt.Fprintln(writer, err)
+		}
+		return false
+	}
+	if keep {
+		repl.Decls, repl.Stmts, repl.output = decls, stmts, out
+	}
+	return true
+}
+
+// AddImports adds the import paths to the session, if not already present
+func (repl *Repl) AddImports(paths ...string) {
+	for _, path := range paths {
+		found := false
+		for _, existing := range repl.Imports {
+			found = found || existing == path
+		}
+		if !found {
+			repl.Imports = append(repl.Imports, path)
+		}
+	}
+}
+
+// Command handles the session commands :import, :reset, :save, :history, :help and :quit
+func (repl *Repl) Command(line string, writer io.Writer) bool {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case ":import":
+		for _, path := range fields[1:] {
+			if unquoted, err := strconv.Unquote(path); err == nil {
+				path = unquoted
+			}
+			repl.AddImports(path)
+		}
+	case ":reset":
+		repl.Imports, repl.Decls, repl.Stmts, repl.pending, repl.output = nil, nil, nil, nil, nil
+	case ":save":
+		if len(fields) != 2 {
+			fmt.Fprintln(writer, "usage: :save FILE")
+			break
+		}
+		if err := repl.Save(fields[1]); err != nil {
+			fmt.Fprintln(writer, err)
+		}
+	case ":history":
+		for number, entry := range repl.History {
+			fmt.Fprintf(writer, "%4d  %s\n", number+1, entry)
+		}
+	case ":help":
+		fmt.Fprint(writer, `Enter Go declarations, statements or expressions, or one of the commands
+	:import PATH...	import packages, most imports are added automatically
+	:reset		start over with an empty program, also discards unfinished multi-line input
+	:save FILE	save the program as runnable script
+	:history	print all lines entered
+	:quit		end the session
+`)
+	case ":quit", ":q":
+		return true
+	default:
+		fmt.Fprintf(writer, "unknown command [%s], see :help\n", fields[0])
+	}
+	return false
+}
+
+// Save writes the program of the session as executable script with hashbang
+func (repl *Repl) Save(filename string) error {
+	src := append([]byte("#!/usr/bin/env goplay\n"), repl.Source(repl.Decls, repl.Stmts)...)
+	return ioutil.WriteFile(filename, src, 0755)
+}
+
+// StatementLines returns the statement, followed by "_ = name" for every variable it declares,
+// so that variables which are not used (yet) do not break the program
+func StatementLines(stmt string) []string {
+	lines := []string{stmt}
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package main\nfunc main() {\n"+stmt+"\n}", 0)
+	if err != nil {
+		return lines
+	}
+	addName := func(ident *ast.Ident) {
+		if ident.Name != "_" {
+			lines = append(lines, "_ = "+ident.Name)
+		}
+	}
+	for _, s := range file.Decls[0].(*ast.FuncDecl).Body.List {
+		switch s := s.(type) {
+		case *ast.AssignStmt:
+			if s.Tok == token.DEFINE {
+				for _, lhs := range s.Lhs {
+					if ident, ok := lhs.(*ast.Ident); ok {
+						addName(ident)
+					}
+				}
+			}
+		case *ast.DeclStmt:
+			if decl, ok := s.Decl.(*ast.GenDecl); ok && decl.Tok == token.VAR {
+				for _, spec := range decl.Specs {
+					for _, ident := range spec.(*ast.ValueSpec).Names {
+						addName(ident)
+					}
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// RunRepl reads lines from reader and evaluates them until the end of input or :quit.
+// Lines continuing multi-line input are prompted with dots instead, like "....... " for "goplay> ".
+func RunRepl(repl *Repl, reader io.Reader, writer io.Writer, prompt string) {
+	scanner := bufio.NewScanner(reader)
+	trimmed := strings.TrimRight(prompt, " ")
+	continuation := strings.Repeat(".", len(trimmed)) + prompt[len(trimmed):]
+	for {
+		if len(repl.pending) > 0 {
+			fmt.Fprint(writer, continuation)
+		} else {
+			fmt.Fprint(writer, prompt)
+		}
+		if !scanner.Scan() {
+			fmt.Fprint(writer, "\n")
+			return
+		}
+		if repl.Eval(scanner.Text(), writer) {
+			return
+		}
+	}
+}
+
+// CompileRunner returns a ReplRunner, which compiles the programs inside dir with "go build".
+// The programs are built like scripts, with the toolchain, build flags and offline mode of the configuration.
+// Compiler positions point to "repl", the lines of the line directives and otherwise the lines of the program.
+func CompileRunner(dir string) ReplRunner {
+	sourcePath := filepath.Join(dir, "repl.go")
+	binaryPath := filepath.Join(dir, "repl")
+	if runtime.GOOS == "windows" {
+		binaryPath += ".exe"
+	}
+	// The options only depend on the configuration, programs never contain directives
+	if err := ioutil.WriteFile(sourcePath, []byte("package main\n"), 0600); err != nil {
+		log.Fatalf("Could not write file: %s", err)
+	}
+	options := ScriptBuildOptions(sourcePath, SourceMap{sourcePath: Source{"repl", 0}, filepath.Join(dir, "repl"): Source{"repl", 0}})
+
+	return func(src []byte) (out []byte, err error) {
+		if err := ioutil.WriteFile(sourcePath, src, 0600); err != nil {
+			return nil, err
+		}
+
+		err = func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					if buildErr, ok := r.(*BuildError); ok {
+						err = buildErr
+					} else {
+						err = fmt.Errorf("%s", r)
+					}
+				}
+			}()
+			if options.Offline != "" {
+				CheckOffline(sourcePath, []string{sourcePath}, false, options)
+			}
+			BuildFiles(append([]string{sourcePath}, options.Includes...), binaryPath, dir, options)
+			return nil
+		}()
+		if buildErr, ok := err.(*BuildError); ok {
+			return []byte(buildErr.Output), err
+		} else if err != nil {
+			return nil, err
+		}
+		if err := CheckPrivateFile(binaryPath); err != nil {
+			return nil, fmt.Errorf("Refusing to run binary: %s", err)
+		}
+
+		cmd := exec.Command(binaryPath)
+		cmd.Dir, _ = os.Getwd()
+		return cmd.CombinedOutput()
+	}
+}
+
+// ReplHistoryFile returns the file the history of all sessions is kept in
+func ReplHistoryFile() string {
+	return filepath.Join(filepath.Dir(SnippetDirectory()), "repl_history")
+}
+
+// ReplCommand implements "goplay repl", an interactive session on stdin
+func ReplCommand(args []string) {
+	if len(args) != 0 {
+		usage()
+	}
+
+	// Programs are built with the configuration of scripts inside the working directory
+	workDir, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ReadConfiguration(workDir)
+	ApplyFlags()
+
+	// Check directory, nobody else may be able to plant binaries in it
+	if err := os.MkdirAll(filepath.Dir(SnippetDirectory()), 0700); err != nil {
+		log.Fatalf("Could not make directory: %s", err)
+	}
+	if err := CheckPrivateFile(filepath.Dir(SnippetDirectory())); err != nil {
+		log.Fatalf("Unsafe cache directory: %s", err)
+	}
+	sessionDir, err := ioutil.TempDir(filepath.Dir(SnippetDirectory()), "repl")
+	if err != nil {
+		log.Fatalf("Could not make directory: %s", err)
+	}
+	defer os.RemoveAll(sessionDir)
+	Verbosef("repl session in [%s]", sessionDir)
+
+	repl := NewRepl(CompileRunner(sessionDir))
+	if data, err := ioutil.ReadFile(ReplHistoryFile()); err == nil {
+		repl.History = strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	}
+	previous := len(repl.History)
+	defer func() {
+		// Append the history of this session
+		file, err := os.OpenFile(ReplHistoryFile(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			messageLog.Printf("warning: could not write history: %s", err)
+			return
+		}
+		defer file.Close()
+		for _, entry := range repl.History[previous:] {
+			fmt.Fprintln(file, entry)
+		}
+	}()
+
+	fmt.Println("goplay", Version(), "- enter Go code, :help for help")
+	RunRepl(repl, os.Stdin, os.Stdout, REPL_PROMPT)
+}
@@ -0,0 +1,143 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRepl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := strings.Join([]string{
+		`greeting := "hello"`,
+		`fmt.Println(greeting)`,
+		`func double(i int) int { return i * 2 }`,
+		`double(21)`,
+		`strings.ToUpper(greeting)`,
+		`fmt.Println("world")`,
+		`:save ` + filepath.Join(dir, "saved.go"),
+		`:quit`,
+		`fmt.Println("never")`,
+	}, "\n")
+
+	var output bytes.Buffer
+	repl := NewRepl(CompileRunner(dir))
+	RunRepl(repl, strings.NewReader(input), &output, "> ")
+
+	// Only new output is shown, printed expressions are not repeated
+	expected(t, "Repl", output.String(), "> > hello\n> > 42\n> HELLO\n> world\n> > ")
+	expected(t, "Repl", len(repl.History), 8)
+	expected(t, "Repl", len(repl.Decls), 1)
+
+	saved, err := ioutil.ReadFile(filepath.Join(dir, "saved.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "Repl", strings.HasPrefix(string(saved), "#!/usr/bin/env goplay\n"), true)
+	expected(t, "Repl", strings.Contains(string(saved), `fmt.Println("world")`), true)
+	expected(t, "Repl", strings.Contains(string(saved), "double(21)"), false)
+}
+
+func TestReplMultiLine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	input := strings.Join([]string{
+		`for i := 0; i < 2; i++ {`,
+		`	fmt.Println(i)`,
+		`}`,
+		`func greet(name string) {`,
+		`	fmt.Println("hello", name)`,
+		`}`,
+		`greet("world")`,
+		`x := undefined +`,
+		`	1`,
+	}, "\n")
+
+	var output bytes.Buffer
+	repl := NewRepl(CompileRunner(dir))
+	RunRepl(repl, strings.NewReader(input), &output, "> ")
+
+	// Compiler positions point to the lines of the history
+	expected(t, "ReplMultiLine", output.String(), "> . . 0\n1\n> . . > hello world\n> . repl:8:6: undefined: undefined\n> \n")
+	expected(t, "ReplMultiLine", len(repl.Decls), 1)
+	expected(t, "ReplMultiLine", len(repl.Stmts), 2)
+}
+
+func TestIncomplete(t *testing.T) {
+	expected(t, "Incomplete", Incomplete("for i := 0; i < 2; i++ {"), true)
+	expected(t, "Incomplete", Incomplete("func f() {"), true)
+	expected(t, "Incomplete", Incomplete("fmt.Println(1,"), true)
+	expected(t, "Incomplete", Incomplete("s := `raw"), true)
+	expected(t, "Incomplete", Incomplete("x := 1"), false)
+	expected(t, "Incomplete", Incomplete("func f() {}"), false)
+	expected(t, "Incomplete", Incomplete("x := )"), false)
+}
+
+func TestCompileRunner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out, err := CompileRunner(dir)([]byte("package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "CompileRunner", string(out), "hello\n")
+
+	// Compiler errors point to the repl
+	out, err = CompileRunner(dir)([]byte("package main\n\nfunc main() {\n\tundefined()\n}\n"))
+	if _, ok := err.(*BuildError); !ok {
+		t.Fatalf("Build problems should be returned as *BuildError, but got [%v]", err)
+	}
+	expected(t, "CompileRunner", strings.HasPrefix(string(out), "repl:4:"), true)
+
+	// Build flags of the configuration are used
+	buildFlags := config.BuildFlags
+	defer func() { config.BuildFlags = buildFlags }()
+	config.BuildFlags = `-ldflags "-X main.value=configured"`
+	out, err = CompileRunner(dir)([]byte("package main\n\nvar value = \"default\"\n\nfunc main() {\n\tprintln(value)\n}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "CompileRunner", string(out), "configured\n")
+}
+
+func TestReplCommands(t *testing.T) {
+	var output bytes.Buffer
+	repl := NewRepl(func(src []byte) ([]byte, error) { return nil, nil })
+	RunRepl(repl, strings.NewReader(":import os \"net/http\"\nx := 1\n:reset\n:history\n:unknown\n"), &output, "")
+
+	expected(t, "ReplCommands", output.String(), "   1  :import os \"net/http\"\n   2  x := 1\n   3  :reset\n   4  :history\n"+
+		"unknown command [:unknown], see :help\n\n")
+	expected(t, "ReplCommands", len(repl.Imports), 0)
+	expected(t, "ReplCommands", len(repl.Stmts), 0)
+
+	repl.Command(":import os \"net/http\" os", &output)
+	expected(t, "ReplCommands", strings.Join(repl.Imports, ","), "os,net/http")
+}
+
+func TestStatementLines(t *testing.T) {
+	expected(t, "StatementLines", strings.Join(StatementLines("a, _ := 1, 2"), "; "), "a, _ := 1, 2; _ = a")
+	expected(t, "StatementLines", strings.Join(StatementLines("var b, c int"), "; "), "var b, c int; _ = b; _ = c")
+	expected(t, "StatementLines", strings.Join(StatementLines("a = 3"), "; "), "a = 3")
+}
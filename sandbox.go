@@ -0,0 +1,197 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Hidden first argument, which makes goplay set up the sandbox inside its new namespaces and start the binary there
+const SANDBOX_INIT = "__sandbox_init"
+
+// Hidden first argument, which makes goplay restrict itself with landlock and seccomp inside the sandbox, and execute the binary
+const SANDBOX_EXEC = "__sandbox_exec"
+
+// SandboxOptions describe the sandbox a binary runs in with -sandbox
+type SandboxOptions struct {
+	Writable []string // Directories which stay writable, everything else is read-only
+	ReadOnly []string // Files and directories inside of the writable directories, which stay read-only nevertheless
+	Network  bool     // Keep the network, instead of an empty network namespace
+	CPU      uint64   // RLIMIT_CPU in seconds, 0 for unlimited
+	Memory   uint64   // RLIMIT_AS in bytes, 0 for unlimited
+	Files    uint64   // RLIMIT_NOFILE, 0 for unlimited
+}
+
+// NewSandboxOptions returns the sandbox for the script: its directory and the temp directory stay writable,
+// the network is only available with -net, and the resource limits come from the configuration.
+// The cache and the local .goplayrc files stay read-only, otherwise the script could plant binaries or build flags for later runs outside of the sandbox.
+func NewSandboxOptions(scriptPath string) SandboxOptions {
+	memory, err := ParseSize(config.SandboxMemory)
+	if err != nil {
+		panic(err) // Already validated while reading the configuration
+	}
+	var writable []string
+	for _, dir := range []string{filepath.Dir(scriptPath), os.TempDir()} {
+		if abs, err := filepath.Abs(RealPath(dir)); err == nil {
+			writable = append(writable, abs)
+		}
+	}
+	// Local .goplayrc files may be read from every parent directory, whether they exist yet or not.
+	// Those in directories writable by other users are never read, like /tmp/.goplayrc.
+	var readOnly []string
+	candidates := []string{CacheRoot(scriptPath)}
+	for dir := filepath.Dir(RealPath(scriptPath)); ; dir = filepath.Dir(dir) {
+		if info, err := os.Stat(dir); err == nil && info.Mode().Perm()&0002 == 0 {
+			candidates = append(candidates, filepath.Join(dir, "."+goplayRc))
+		}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	for _, path := range candidates {
+		abs, err := filepath.Abs(RealPath(path))
+		if err != nil {
+			continue
+		}
+		for _, dir := range writable {
+			if strings.HasPrefix(abs, strings.TrimSuffix(dir, "/")+"/") {
+				readOnly = append(readOnly, abs)
+				break
+			}
+		}
+	}
+	return SandboxOptions{
+		Writable: writable,
+		ReadOnly: readOnly,
+		Network:  *netFlag,
+		CPU:      uint64(config.SandboxCPU),
+		Memory:   memory,
+		Files:    uint64(config.SandboxFiles),
+	}
+}
+
+// RealPath returns the path with all symlinks resolved, which mount points are compared with.
+// The directory of a path that does not exist yet is resolved instead.
+func RealPath(path string) string {
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real
+	}
+	if real, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		return filepath.Join(real, filepath.Base(path))
+	}
+	return path
+}
+
+// Environment variables passed into the sandbox, all others may hold secrets. Names ending with "*" are prefixes.
+var sandboxEnv = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "TERM", "COLORTERM", "NO_COLOR", "LANG", "LANGUAGE", "LC_*", "TZ", "TMPDIR",
+	"GOMAXPROCS", "GOGC", "GOMEMLIMIT", "GODEBUG", "GOTRACEBACK"}
+
+// SandboxEnv returns the variables of environ, which are passed into the sandbox
+func SandboxEnv(environ []string) (env []string) {
+	for _, variable := range environ {
+		name := strings.SplitN(variable, "=", 2)[0]
+		for _, allowed := range sandboxEnv {
+			if name == allowed || strings.HasSuffix(allowed, "*") && strings.HasPrefix(name, strings.TrimSuffix(allowed, "*")) {
+				env = append(env, variable)
+				break
+			}
+		}
+	}
+	return env
+}
+
+// Build flags which run other programs while building, "-ldflags" must not change the external linker either
+var sandboxBuildFlags = []string{"toolexec", "exec", "compiler", "gccgoflags"}
+
+// CheckSandboxBuild returns an error, if building the script for -sandbox could run programs chosen by the script.
+// The build runs outside of the sandbox, so neither the script nor local .goplayrc files may select the go binary or flags running other programs.
+func CheckSandboxBuild(scriptPath string, options BuildOptions) error {
+	if IsToolchainPath(options.Toolchain) && (len(options.Directives(scriptPath, "go")) > 0 || IsLocalConfiguration("GoToolchain")) {
+		return fmt.Errorf("the go binary [%s] is selected by the script", options.Toolchain)
+	}
+	if config.BuildFlags != "" && IsLocalConfiguration("BuildFlags") {
+		return fmt.Errorf("BuildFlags of %s are not allowed", configSources[NormalizeKey("BuildFlags")])
+	}
+	for i, flag := range options.Flags {
+		if !strings.HasPrefix(flag, "-") {
+			continue
+		}
+		name, value := strings.TrimLeft(flag, "-"), ""
+		if index := strings.Index(name, "="); index != -1 {
+			name, value = name[:index], name[index+1:]
+		} else if i+1 < len(options.Flags) {
+			value = options.Flags[i+1]
+		}
+		for _, forbidden := range sandboxBuildFlags {
+			if name == forbidden {
+				return fmt.Errorf("build flag [%s] is not allowed", flag)
+			}
+		}
+		if name == "ldflags" && strings.Contains(value, "extld") {
+			return fmt.Errorf("build flag [%s %s] is not allowed", flag, value)
+		}
+	}
+	return nil
+}
+
+// Args returns the arguments of SANDBOX_INIT, for starting the binary with its arguments in the sandbox
+func (options SandboxOptions) Args(binaryPath string, args []string) []string {
+	sandboxArgs := []string{SANDBOX_INIT,
+		"-writable", strings.Join(options.Writable, string(os.PathListSeparator)),
+		"-readonly", strings.Join(options.ReadOnly, string(os.PathListSeparator)),
+		"-cpu", strconv.FormatUint(options.CPU, 10),
+		"-memory", strconv.FormatUint(options.Memory, 10),
+		"-files", strconv.FormatUint(options.Files, 10),
+	}
+	if options.Network {
+		sandboxArgs = append(sandboxArgs, "-net")
+	}
+	return append(append(sandboxArgs, "--", binaryPath), args...)
+}
+
+// ParseSandboxArgs is the counterpart of SandboxOptions.Args, it returns the sandbox options and the command to run inside of it
+func ParseSandboxArgs(args []string) (options SandboxOptions, command []string, err error) {
+	flags := flag.NewFlagSet(SANDBOX_INIT, flag.ContinueOnError)
+	writable := flags.String("writable", "", "writable directories")
+	readOnly := flags.String("readonly", "", "read-only paths inside of the writable directories")
+	flags.BoolVar(&options.Network, "net", false, "keep network")
+	flags.Uint64Var(&options.CPU, "cpu", 0, "cpu seconds")
+	flags.Uint64Var(&options.Memory, "memory", 0, "address space bytes")
+	flags.Uint64Var(&options.Files, "files", 0, "open files")
+	if err := flags.Parse(args); err != nil {
+		return options, nil, err
+	}
+	if flags.NArg() == 0 {
+		return options, nil, fmt.Errorf("%s: missing command", SANDBOX_INIT)
+	}
+	options.Writable = filepath.SplitList(*writable)
+	options.ReadOnly = filepath.SplitList(*readOnly)
+	return options, flags.Args(), nil
+}
+
+// ParseSize parses a size in bytes, optionally with a K, M, G or T suffix for KiB, MiB, GiB and TiB. An empty size is 0.
+func ParseSize(size string) (uint64, error) {
+	value := strings.ToUpper(strings.TrimSpace(size))
+	if value == "" {
+		return 0, nil
+	}
+	shift := uint(0)
+	if i := strings.IndexByte("KMGT", value[len(value)-1]); i >= 0 {
+		shift = 10 * uint(i+1)
+		value = strings.TrimSpace(value[:len(value)-1])
+	}
+	bytes, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || bytes > (^uint64(0))>>shift {
+		return 0, fmt.Errorf("invalid size [%s], must be a number of bytes optionally followed by K, M, G or T", size)
+	}
+	return bytes << shift, nil
+}
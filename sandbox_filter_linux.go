@@ -0,0 +1,202 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Landlock syscalls and constants, which are missing in package syscall. New syscalls have the same number on all architectures.
+const (
+	SYS_LANDLOCK_CREATE_RULESET = 444
+	SYS_LANDLOCK_ADD_RULE       = 445
+	SYS_LANDLOCK_RESTRICT_SELF  = 446
+
+	O_PATH = 0x200000 // Except on sparc, which goplay does not support
+
+	LANDLOCK_CREATE_RULESET_VERSION = 1
+	LANDLOCK_RULE_PATH_BENEATH      = 1
+
+	LANDLOCK_ACCESS_FS_WRITE_FILE  = 1 << 1
+	LANDLOCK_ACCESS_FS_REMOVE_DIR  = 1 << 4
+	LANDLOCK_ACCESS_FS_REMOVE_FILE = 1 << 5
+	LANDLOCK_ACCESS_FS_MAKE_CHAR   = 1 << 6
+	LANDLOCK_ACCESS_FS_MAKE_DIR    = 1 << 7
+	LANDLOCK_ACCESS_FS_MAKE_REG    = 1 << 8
+	LANDLOCK_ACCESS_FS_MAKE_SOCK   = 1 << 9
+	LANDLOCK_ACCESS_FS_MAKE_FIFO   = 1 << 10
+	LANDLOCK_ACCESS_FS_MAKE_BLOCK  = 1 << 11
+	LANDLOCK_ACCESS_FS_MAKE_SYM    = 1 << 12
+	LANDLOCK_ACCESS_FS_REFER       = 1 << 13
+	LANDLOCK_ACCESS_FS_TRUNCATE    = 1 << 14
+)
+
+// RestrictFilesystem allows writing only beneath the writable directories and to the devices of /dev, for the current thread and the programs it executes.
+// It returns false, if the kernel does not support landlock and the read-only mounts are the only protection.
+// Landlock can only grant access beneath a directory, the read-only paths inside of the writable directories are protected by their read-only bind mounts,
+// which deny writing whatever landlock allows.
+func RestrictFilesystem(writable []string) (bool, error) {
+	abi, _, errno := syscall.Syscall(SYS_LANDLOCK_CREATE_RULESET, 0, 0, LANDLOCK_CREATE_RULESET_VERSION)
+	if errno == syscall.ENOSYS || errno == syscall.EOPNOTSUPP {
+		return false, nil
+	} else if errno != 0 {
+		return false, fmt.Errorf("landlock version: %s", errno)
+	}
+
+	handled := uint64(LANDLOCK_ACCESS_FS_WRITE_FILE | LANDLOCK_ACCESS_FS_REMOVE_DIR | LANDLOCK_ACCESS_FS_REMOVE_FILE |
+		LANDLOCK_ACCESS_FS_MAKE_CHAR | LANDLOCK_ACCESS_FS_MAKE_DIR | LANDLOCK_ACCESS_FS_MAKE_REG | LANDLOCK_ACCESS_FS_MAKE_SOCK |
+		LANDLOCK_ACCESS_FS_MAKE_FIFO | LANDLOCK_ACCESS_FS_MAKE_BLOCK | LANDLOCK_ACCESS_FS_MAKE_SYM)
+	devices := uint64(LANDLOCK_ACCESS_FS_WRITE_FILE)
+	if abi >= 2 {
+		handled |= LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		handled |= LANDLOCK_ACCESS_FS_TRUNCATE
+		devices |= LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+
+	ruleset := struct{ handledAccessFs uint64 }{handled}
+	fd, _, errno := syscall.Syscall(SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&ruleset)), unsafe.Sizeof(ruleset), 0)
+	if errno != 0 {
+		return false, fmt.Errorf("landlock ruleset: %s", errno)
+	}
+	defer syscall.Close(int(fd))
+
+	rules := map[string]uint64{"/dev": devices}
+	for _, dir := range writable {
+		rules[dir] = handled
+	}
+	for path, access := range rules {
+		dir, err := syscall.Open(path, O_PATH|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return false, fmt.Errorf("landlock rule for [%s]: %s", path, err)
+		}
+		rule := struct {
+			allowedAccess uint64
+			parentFd      int32
+		}{access, int32(dir)}
+		_, _, errno := syscall.Syscall6(SYS_LANDLOCK_ADD_RULE, fd, LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0)
+		syscall.Close(dir)
+		if errno != 0 {
+			return false, fmt.Errorf("landlock rule for [%s]: %s", path, errno)
+		}
+	}
+	if _, _, errno := syscall.Syscall(SYS_LANDLOCK_RESTRICT_SELF, fd, 0, 0); errno != 0 {
+		return false, fmt.Errorf("landlock restrict: %s", errno)
+	}
+	return true, nil
+}
+
+// Seccomp constants, which are missing in package syscall
+const (
+	PR_SET_SECCOMP      = 22
+	SECCOMP_MODE_FILTER = 2
+
+	SECCOMP_RET_KILL_PROCESS = 0x80000000
+	SECCOMP_RET_ERRNO        = 0x00050000
+	SECCOMP_RET_ALLOW        = 0x7fff0000
+
+	CLONE_NEWCGROUP = 0x02000000
+)
+
+// seccompArch is the audit architecture of a GOARCH and its syscalls, which package syscall is missing on some architectures:
+// name_to_handle_at, open_by_handle_at, setns, process_vm_readv, process_vm_writev, finit_module, bpf and userfaultfd
+type seccompArch struct {
+	audit    uint32
+	syscalls []uint32
+}
+
+var seccompArchs = map[string]seccompArch{
+	"amd64":   {0xc000003e, []uint32{303, 304, 308, 310, 311, 313, 321, 323}},
+	"386":     {0x40000003, []uint32{341, 342, 346, 347, 348, 350, 357, 374}},
+	"arm":     {0x40000028, []uint32{370, 371, 375, 376, 377, 379, 386, 388}},
+	"arm64":   {0xc00000b7, []uint32{264, 265, 268, 270, 271, 273, 280, 282}},
+	"riscv64": {0xc00000f3, []uint32{264, 265, 268, 270, 271, 273, 280, 282}},
+	"ppc64le": {0xc0000015, []uint32{345, 346, 350, 351, 352, 353, 361, 364}},
+	"s390x":   {0x80000016, []uint32{335, 336, 339, 340, 341, 344, 351, 355}},
+}
+
+// Syscalls denied in the sandbox: changing mounts and namespaces, tracing other processes, the kernel keyring, modules, tracing the kernel and administration.
+// The new mount API (open_tree, move_mount, fsopen, fsconfig, fsmount, fspick and mount_setattr) has the same numbers on all architectures.
+var seccompDenied = []uint32{syscall.SYS_MOUNT, syscall.SYS_UMOUNT2, syscall.SYS_PIVOT_ROOT, syscall.SYS_CHROOT, syscall.SYS_UNSHARE, syscall.SYS_PTRACE,
+	syscall.SYS_KEYCTL, syscall.SYS_ADD_KEY, syscall.SYS_REQUEST_KEY, syscall.SYS_PERF_EVENT_OPEN,
+	syscall.SYS_INIT_MODULE, syscall.SYS_DELETE_MODULE, syscall.SYS_KEXEC_LOAD, syscall.SYS_REBOOT,
+	syscall.SYS_SWAPON, syscall.SYS_SWAPOFF, syscall.SYS_ACCT,
+	428, 429, 430, 431, 432, 433, 442}
+
+// clone3 passes its flags in memory, which seccomp can't check. It fails with ENOSYS, so that programs fall back to clone.
+const SYS_CLONE3 = 435
+
+// Namespace flags of clone, which are denied like unshare
+const cloneNamespaces = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWNET | syscall.CLONE_NEWPID |
+	syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS | CLONE_NEWCGROUP
+
+// SeccompFilter returns the seccomp program of the sandbox for an architecture.
+// Other architectures are killed, denied syscalls fail with EPERM and everything else is allowed.
+func SeccompFilter(goarch string) ([]syscall.SockFilter, error) {
+	arch, ok := seccompArchs[goarch]
+	if !ok {
+		return nil, fmt.Errorf("no seccomp filter for %s", goarch)
+	}
+	statement := func(code uint16, k uint32) syscall.SockFilter {
+		return syscall.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) syscall.SockFilter {
+		return syscall.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+	deny := statement(syscall.BPF_RET|syscall.BPF_K, SECCOMP_RET_ERRNO|uint32(syscall.EPERM))
+
+	// Offsets in struct seccomp_data, the flags of clone are the second argument on s390x and big endian there
+	const nrOffset, archOffset = 0, 4
+	flagsOffset := uint32(16)
+	if goarch == "s390x" {
+		flagsOffset = 24 + 4
+	}
+
+	filter := []syscall.SockFilter{
+		statement(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, archOffset),
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, arch.audit, 1, 0),
+		statement(syscall.BPF_RET|syscall.BPF_K, SECCOMP_RET_KILL_PROCESS),
+		statement(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, nrOffset),
+		// The x32 syscalls of amd64
+		jump(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, 0x40000000, 0, 1),
+		deny,
+	}
+	for _, nr := range append(append([]uint32{}, seccompDenied...), arch.syscalls...) {
+		filter = append(filter, jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr, 0, 1), deny)
+	}
+	filter = append(filter,
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, SYS_CLONE3, 0, 1),
+		statement(syscall.BPF_RET|syscall.BPF_K, SECCOMP_RET_ERRNO|uint32(syscall.ENOSYS)),
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, syscall.SYS_CLONE, 0, 3),
+		statement(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, flagsOffset),
+		jump(syscall.BPF_JMP|syscall.BPF_JSET|syscall.BPF_K, cloneNamespaces, 0, 1),
+		deny,
+		statement(syscall.BPF_RET|syscall.BPF_K, SECCOMP_RET_ALLOW),
+	)
+	return filter, nil
+}
+
+// InstallSeccompFilter installs the seccomp filter of the sandbox for the current thread and the programs it executes.
+// It needs no_new_privs, which SandboxExec sets first.
+func InstallSeccompFilter() error {
+	filter, err := SeccompFilter(runtime.GOARCH)
+	if err != nil {
+		return err
+	}
+	program := syscall.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, PR_SET_SECCOMP, SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&program))); errno != 0 {
+		return errno
+	}
+	return nil
+}
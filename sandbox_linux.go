@@ -0,0 +1,403 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Mount options of /proc/self/mountinfo, which have to be kept when remounting
+var mountFlags = map[string]uintptr{
+	"ro":          syscall.MS_RDONLY,
+	"nosuid":      syscall.MS_NOSUID,
+	"nodev":       syscall.MS_NODEV,
+	"noexec":      syscall.MS_NOEXEC,
+	"noatime":     syscall.MS_NOATIME,
+	"nodiratime":  syscall.MS_NODIRATIME,
+	"relatime":    syscall.MS_RELATIME,
+	"strictatime": syscall.MS_STRICTATIME,
+}
+
+// Mount is a single mount point of /proc/self/mountinfo, with the flags of its mount options
+type Mount struct {
+	Path  string
+	Flags uintptr
+}
+
+// SandboxCommand returns the command starting the binary of cmd inside a sandbox.
+//
+// goplay itself is started in new user, mount, pid, ipc and uts namespaces, and without -net in an empty network namespace,
+// with only the environment variables of SandboxEnv. There it makes the filesystem read-only except for the writable directories,
+// sets the resource limits and starts itself again in another user namespace, without any privileges to undo all of that.
+// That last goplay restricts itself with landlock and seccomp, and executes the binary.
+func SandboxCommand(cmd *exec.Cmd, options SandboxOptions) *exec.Cmd {
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatalf("Could not find goplay executable for the sandbox: %s", err)
+	}
+	sandbox := exec.Command(self, options.Args(cmd.Path, cmd.Args[1:])...)
+	sandbox.Dir = cmd.Dir
+	sandbox.Env = SandboxEnv(os.Environ())
+
+	flags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS)
+	if !options.Network {
+		flags |= syscall.CLONE_NEWNET
+	}
+	sandbox.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  flags,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+	return sandbox
+}
+
+// SandboxInit runs inside the namespaces created by SandboxCommand, sets up the sandbox and runs the command in it.
+// As pid 1 of the sandbox it forwards signals to the command and exits with its exit code.
+func SandboxInit(args []string) {
+	if os.Getpid() != 1 {
+		log.Fatalf("%s must only be started by goplay -sandbox, inside its own namespaces", SANDBOX_INIT)
+	}
+	options, command, err := ParseSandboxArgs(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		log.Fatal(err)
+	}
+	locks, err := SetupSandboxFilesystem(options.Writable, options.ReadOnly)
+	if err != nil {
+		ReleaseReadOnly(locks)
+		log.Fatalf("Could not set up sandbox filesystem: %s", err)
+	}
+	if err := SetSandboxLimits(options); err != nil {
+		log.Fatalf("Could not set sandbox limits: %s", err)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, PR_SET_NO_NEW_PRIVS, 1, 0); errno != 0 {
+		log.Fatalf("Could not set no_new_privs: %s", errno)
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	execArgs := options.Args(command[0], command[1:])
+	execArgs[0] = SANDBOX_EXEC
+	cmd := exec.Command(self, execArgs...)
+	cmd.Dir = wd // Resolved again, to end up on the writable bind mount
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	uid, gid := HostIds()
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: uid, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: gid, HostID: os.Getgid(), Size: 1}},
+		Pdeathsig:   syscall.SIGKILL,
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	if err := cmd.Start(); err != nil {
+		ReleaseReadOnly(locks)
+		log.Fatalf("Could not execute: %q\n%s", cmd.Args, err)
+	}
+	go func() {
+		for sig := range signals {
+			cmd.Process.Signal(sig)
+		}
+	}()
+	err = cmd.Wait()
+	ReleaseReadOnly(locks)
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+				os.Exit(128 + int(status.Signal()))
+			}
+			os.Exit(exitErr.ExitCode())
+		}
+		log.Fatal(err)
+	}
+}
+
+// SandboxExec runs as the last step inside the sandbox, it restricts itself with landlock and seccomp and executes the command.
+// Both are inherited by the command and can't be lifted anymore.
+func SandboxExec(args []string) {
+	if os.Getppid() != 1 {
+		log.Fatalf("%s must only be started by goplay -sandbox, inside its own namespaces", SANDBOX_EXEC)
+	}
+	options, command, err := ParseSandboxArgs(args)
+	if err != nil {
+		log.Fatal(err)
+	}
+	path, err := exec.LookPath(command[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// no_new_privs, landlock and seccomp only apply to the thread setting them, which has to be the one executing the command
+	runtime.LockOSThread()
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, PR_SET_NO_NEW_PRIVS, 1, 0); errno != 0 {
+		log.Fatalf("Could not set no_new_privs: %s", errno)
+	}
+	if restricted, err := RestrictFilesystem(options.Writable); err != nil {
+		log.Fatalf("Could not restrict sandbox filesystem: %s", err)
+	} else if !restricted {
+		messageLog.Printf("warning: sandbox filesystem is only read-only, the kernel does not support landlock")
+	}
+	if err := InstallSeccompFilter(); err != nil {
+		log.Fatalf("Could not install seccomp filter: %s", err)
+	}
+	if err := syscall.Exec(path, command, os.Environ()); err != nil {
+		log.Fatalf("Could not execute: %q\n%s", command, err)
+	}
+}
+
+// prctl option, which is missing in package syscall
+const PR_SET_NO_NEW_PRIVS = 38
+
+// HostIds returns the user and group id outside of the sandbox, which the command runs as again
+func HostIds() (uid int, gid int) {
+	uid, gid = os.Getuid(), os.Getgid()
+	if id, err := MappedId("/proc/self/uid_map", uid); err == nil {
+		uid = id
+	}
+	if id, err := MappedId("/proc/self/gid_map", gid); err == nil {
+		gid = id
+	}
+	return uid, gid
+}
+
+// MappedId returns the id outside of the user namespace, for an id inside of it
+func MappedId(mapFile string, id int) (int, error) {
+	data, err := ioutil.ReadFile(mapFile)
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		var inside, outside, size int
+		if _, err := fmt.Sscan(line, &inside, &outside, &size); err == nil && id >= inside && id < inside+size {
+			return outside + id - inside, nil
+		}
+	}
+	return 0, fmt.Errorf("id %d is not mapped in %s", id, mapFile)
+}
+
+// SetupSandboxFilesystem makes all mounts read-only, except for the writable directories which keep their mount options,
+// and mounts a /proc for the new pid namespace. The read-only paths inside of the writable directories are bind mounted read-only,
+// missing ones are created as empty placeholder files first, so that the command can't create them either.
+// It returns the locks of the read-only files, which ReleaseReadOnly releases after the command exited.
+func SetupSandboxFilesystem(writable []string, readOnly []string) (locks []ReadOnlyLock, err error) {
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return nil, fmt.Errorf("making mounts private: %s", err)
+	}
+	for _, dir := range writable {
+		if err := syscall.Mount(dir, dir, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return nil, fmt.Errorf("bind mounting [%s]: %s", dir, err)
+		}
+	}
+	for _, path := range readOnly {
+		lock, err := LockReadOnly(path)
+		if err != nil {
+			return locks, err
+		}
+		if lock.File != nil {
+			locks = append(locks, lock)
+		}
+		if err := syscall.Mount(path, path, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return locks, fmt.Errorf("bind mounting [%s]: %s", path, err)
+		}
+	}
+	if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		Verbosef("sandbox keeps /proc of the host: %s", err)
+	}
+
+	data, err := ioutil.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return locks, err
+	}
+	mounts, err := ParseMountInfo(data)
+	if err != nil {
+		return locks, err
+	}
+	for _, mount := range mounts {
+		if mount.Path == "/proc" {
+			continue // Needed for the user namespace of the command, which is protected by the permissions of /proc anyway
+		}
+		if err := Remount(mount.Path, mount.Flags|syscall.MS_RDONLY); err != nil {
+			return locks, err
+		}
+	}
+	for _, mount := range mounts {
+		if IsBeneath(mount.Path, readOnly) {
+			continue
+		}
+		if IsBeneath(mount.Path, writable) {
+			if err := Remount(mount.Path, mount.Flags); err != nil {
+				return locks, err
+			}
+		}
+	}
+	return locks, nil
+}
+
+// IsBeneath returns true, if the path is one of the directories or inside of one of them
+func IsBeneath(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOnlyLock is a read-only file of the sandbox, which is locked shared while the sandbox runs.
+// Created is true for placeholders of missing files, which are removed again by the last sandbox using them.
+type ReadOnlyLock struct {
+	Path    string
+	File    *os.File
+	Created bool
+}
+
+// LockReadOnly locks the read-only file at path, a missing file is created as empty placeholder. Directories are not locked.
+func LockReadOnly(path string) (ReadOnlyLock, error) {
+	lock := ReadOnlyLock{Path: path}
+	for {
+		info, err := os.Lstat(path)
+		switch {
+		case os.IsNotExist(err):
+			lock.File, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDONLY, 0644)
+			if os.IsExist(err) {
+				continue // Created by another sandbox meanwhile
+			}
+			lock.Created = true
+		case err != nil:
+			return lock, err
+		case info.IsDir():
+			return lock, nil
+		default:
+			lock.File, err = os.Open(path)
+		}
+		if err != nil {
+			return lock, fmt.Errorf("locking [%s]: %s", path, err)
+		}
+		if err := syscall.Flock(int(lock.File.Fd()), syscall.LOCK_SH); err != nil {
+			lock.File.Close()
+			return lock, fmt.Errorf("locking [%s]: %s", path, err)
+		}
+		// Another sandbox may have removed its placeholder before the lock was granted, which then has to be created again
+		locked, _ := lock.File.Stat()
+		if current, err := os.Lstat(path); err == nil && os.SameFile(locked, current) {
+			return lock, nil
+		}
+		lock.File.Close()
+		lock.Created = false
+	}
+}
+
+// ReleaseReadOnly unlocks the read-only files of the sandbox. Placeholders are unmounted and removed, unless another sandbox still uses them
+// or they were written outside of the sandbox meanwhile.
+func ReleaseReadOnly(locks []ReadOnlyLock) {
+	for _, lock := range locks {
+		if lock.Created && syscall.Flock(int(lock.File.Fd()), syscall.LOCK_EX|syscall.LOCK_NB) == nil {
+			syscall.Unmount(lock.Path, syscall.MNT_DETACH)
+			if info, err := lock.File.Stat(); err == nil && info.Size() == 0 {
+				os.Remove(lock.Path)
+			}
+		}
+		lock.File.Close()
+	}
+}
+
+// Remount changes the flags of a mount. Mounts the command can't reach either, because they are hidden or not accessible, are skipped.
+func Remount(path string, flags uintptr) error {
+	err := syscall.Mount("", path, "", syscall.MS_BIND|syscall.MS_REMOUNT|flags, "")
+	switch err {
+	case nil:
+		return nil
+	case syscall.EACCES, syscall.ENOENT, syscall.EINVAL:
+		Verbosef("sandbox skips mount [%s]: %s", path, err)
+		return nil
+	}
+	return fmt.Errorf("remounting [%s]: %s", path, err)
+}
+
+// ParseMountInfo returns the mounts of a /proc/PID/mountinfo file, in order of mounting
+func ParseMountInfo(data []byte) (mounts []Mount, err error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		path, err := UnescapeMountPath(fields[4])
+		if err != nil {
+			return nil, err
+		}
+		mount := Mount{Path: path}
+		for _, option := range strings.Split(fields[5], ",") {
+			mount.Flags |= mountFlags[option]
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts, scanner.Err()
+}
+
+// UnescapeMountPath replaces the octal escapes of mountinfo, like "\040" for a space
+func UnescapeMountPath(path string) (string, error) {
+	var unescaped strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			code, err := strconv.ParseUint(path[i+1:i+4], 8, 8)
+			if err != nil {
+				return "", fmt.Errorf("invalid mount point [%s]", path)
+			}
+			unescaped.WriteByte(byte(code))
+			i += 3
+			continue
+		}
+		unescaped.WriteByte(path[i])
+	}
+	return unescaped.String(), nil
+}
+
+// SetSandboxLimits sets the resource limits of the options, which are inherited by the command
+func SetSandboxLimits(options SandboxOptions) error {
+	limits := []struct {
+		resource int
+		value    uint64
+		name     string
+	}{
+		{syscall.RLIMIT_CPU, options.CPU, "RLIMIT_CPU"},
+		{syscall.RLIMIT_AS, options.Memory, "RLIMIT_AS"},
+		{syscall.RLIMIT_NOFILE, options.Files, "RLIMIT_NOFILE"},
+	}
+	for _, limit := range limits {
+		if limit.value == 0 {
+			continue
+		}
+		if err := syscall.Setrlimit(limit.resource, &syscall.Rlimit{Cur: limit.value, Max: limit.value}); err != nil {
+			return fmt.Errorf("%s: %s", limit.name, err)
+		}
+	}
+	return nil
+}
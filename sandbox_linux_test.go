@@ -0,0 +1,156 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	mountInfo := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+23 22 0:5 / /dev rw,nosuid,noexec,relatime shared:2 - devtmpfs udev rw
+24 22 8:2 / /mnt/my\040disk ro,nodev,noatime - ext4 /dev/sda2 ro
+`
+	mounts, err := ParseMountInfo([]byte(mountInfo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := []Mount{
+		{"/", syscall.MS_RELATIME},
+		{"/dev", syscall.MS_NOSUID | syscall.MS_NOEXEC | syscall.MS_RELATIME},
+		{"/mnt/my disk", syscall.MS_RDONLY | syscall.MS_NODEV | syscall.MS_NOATIME},
+	}
+	if !reflect.DeepEqual(mounts, wanted) {
+		t.Errorf("Mounts should be %v, but were %v", wanted, mounts)
+	}
+}
+
+func TestSetSandboxLimits(t *testing.T) {
+	// All limits of 0 are unlimited, and don't change anything
+	if err := SetSandboxLimits(SandboxOptions{}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSeccompFilter(t *testing.T) {
+	for goarch := range seccompArchs {
+		filter, err := SeccompFilter(goarch)
+		if err != nil || len(filter) > 255 { // Jumps over the filter must fit into 8 bits
+			t.Errorf("Seccomp filter for %s should be built, but was %d instructions (%v)", goarch, len(filter), err)
+		}
+	}
+	if _, err := SeccompFilter("mips"); err == nil {
+		t.Error("Seccomp filter for an unknown architecture should not be built")
+	}
+}
+
+const escapeScript = `package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+func main() {
+	home, _ := os.UserHomeDir()
+	fmt.Println("home:", ioutil.WriteFile(filepath.Join(home, "escaped"), []byte("escaped"), 0644) != nil)
+	fmt.Println("script dir:", ioutil.WriteFile(filepath.Join(os.Args[2], "written"), []byte("written"), 0644) == nil)
+	binary, _ := os.Executable()
+	fmt.Println("cache:", ioutil.WriteFile(filepath.Join(filepath.Dir(binary), "planted"), []byte("planted"), 0755) != nil)
+	fmt.Println("goplayrc:", ioutil.WriteFile(filepath.Join(os.Args[2], ".goplayrc"), []byte("BuildFlags -toolexec=/tmp/evil\n"), 0644) != nil)
+	_, err := net.Dial("tcp", os.Args[1])
+	fmt.Println("network:", err != nil)
+	fmt.Println("secret:", os.Getenv("TEST_SECRET_TOKEN") == "")
+	fmt.Println("namespace:", syscall.Unshare(syscall.CLONE_NEWUSER) != nil)
+	_, _, errno := syscall.RawSyscall(syscall.SYS_PTRACE, syscall.PTRACE_TRACEME, 0, 0)
+	fmt.Println("ptrace:", errno == syscall.EPERM)
+}
+`
+
+func TestSandboxEscape(t *testing.T) {
+	probe := exec.Command("true")
+	probe.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags:  syscall.CLONE_NEWUSER,
+		UidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings: []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+	}
+	if err := probe.Run(); err != nil {
+		t.Skipf("Unprivileged user namespaces are not available: %s", err)
+	}
+
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	home, err := ioutil.TempDir("", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	script := filepath.Join(dir, "escape.go")
+	if err := ioutil.WriteFile(script, []byte(escapeScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	connected := make(chan bool, 1)
+	go func() {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+			connected <- true
+		}
+	}()
+
+	// The build cache stays where it is, even though HOME changes
+	gocache, _ := exec.Command("go", "env", "GOCACHE").Output()
+	cmd := exec.Command("goplay", "-sandbox", script, listener.Addr().String(), dir)
+	// The temp directory stays writable, so it is the script directory, and HOME is not inside of it
+	cmd.Env = append(os.Environ(), "HOME="+home, "TMPDIR="+dir, "GOCACHE="+strings.TrimSpace(string(gocache)), "TEST_SECRET_TOKEN=hunter2")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	expected(t, "sandbox escape", string(out), "home: true\nscript dir: true\ncache: true\ngoplayrc: true\nnetwork: true\nsecret: true\nnamespace: true\nptrace: true\n")
+	if !Exist(filepath.Join(dir, "written")) {
+		t.Error("Script should be able to write into its own directory")
+	}
+	if Exist(filepath.Join(home, "escaped")) {
+		t.Error("Script should not be able to write into HOME")
+	}
+	// Later runs outside of the sandbox must not pick up binaries or configuration planted by the script
+	if planted, _ := filepath.Glob(filepath.Join(dir, ".goplay", "*", "planted")); len(planted) > 0 {
+		t.Error("Script should not be able to write into the cache")
+	}
+	if Exist(filepath.Join(dir, ".goplayrc")) {
+		t.Error("Script should not be able to create a .goplayrc, and its placeholder should be removed")
+	}
+	select {
+	case <-connected:
+		t.Error("Script should not be able to reach the network")
+	default:
+	}
+}
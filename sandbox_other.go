@@ -0,0 +1,31 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"log"
+	"os/exec"
+)
+
+// SandboxCommand exits, the sandbox needs the namespaces of linux
+func SandboxCommand(cmd *exec.Cmd, options SandboxOptions) *exec.Cmd {
+	log.Fatal("-sandbox is only supported on linux")
+	return nil
+}
+
+// SandboxInit exits, the sandbox needs the namespaces of linux
+func SandboxInit(args []string) {
+	log.Fatal("-sandbox is only supported on linux")
+}
+
+// SandboxExec exits, the sandbox needs the namespaces of linux
+func SandboxExec(args []string) {
+	log.Fatal("-sandbox is only supported on linux")
+}
@@ -0,0 +1,143 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	sizes := map[string]uint64{
+		"":      0,
+		"0":     0,
+		"4096":  4096,
+		"512K":  512 << 10,
+		"512M":  512 << 20,
+		" 2 g ": 2 << 30,
+		"1T":    1 << 40,
+	}
+	for value, size := range sizes {
+		if parsed, err := ParseSize(value); err != nil || parsed != size {
+			t.Errorf("[%s] should be parsed as %d, but was %d (%v)", value, size, parsed, err)
+		}
+	}
+	for _, value := range []string{"M", "-1", "1.5G", "lots", "99999999999999999999T"} {
+		if _, err := ParseSize(value); err == nil {
+			t.Errorf("[%s] should not be accepted as size", value)
+		}
+	}
+}
+
+func TestSandboxArgs(t *testing.T) {
+	options := SandboxOptions{Writable: []string{"/scripts", "/tmp"}, ReadOnly: []string{"/scripts/.goplay", "/scripts/.goplayrc"}, Network: true, CPU: 10, Memory: 512 << 20, Files: 64}
+	args := options.Args("/scripts/.goplay/hello", []string{"-name", "--", "World"})
+	expected(t, "SandboxArgs", args[0], SANDBOX_INIT)
+
+	parsed, command, err := ParseSandboxArgs(args[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, options) {
+		t.Errorf("Sandbox options should be [%v], but were [%v]", options, parsed)
+	}
+	expected(t, "SandboxArgs", strings.Join(command, " "), "/scripts/.goplay/hello -name -- World")
+
+	if _, _, err := ParseSandboxArgs([]string{"-net"}); err == nil {
+		t.Error("Sandbox arguments without command should not be accepted")
+	}
+}
+
+func TestNewSandboxOptions(t *testing.T) {
+	defer func(memory string, flag bool, directory string) {
+		config.SandboxMemory, *netFlag, config.GoplayDirectory = memory, flag, directory
+	}(config.SandboxMemory, *netFlag, config.GoplayDirectory)
+	config.SandboxMemory = "1G"
+	config.GoplayDirectory = ".goplay"
+	*netFlag = false
+
+	options := NewSandboxOptions("hashbang.go")
+	if len(options.Writable) != 2 || !strings.HasSuffix(options.Writable[0], "testdata") {
+		t.Errorf("Script directory and temp directory should be writable, but were %v", options.Writable)
+	}
+	wanted := []string{filepath.Join(options.Writable[0], ".goplay"), filepath.Join(options.Writable[0], ".goplayrc")}
+	if !reflect.DeepEqual(options.ReadOnly, wanted) {
+		t.Errorf("Cache and local .goplayrc should stay read-only, but were %v", options.ReadOnly)
+	}
+	if options.Network || options.Memory != 1<<30 {
+		t.Errorf("Sandbox options should follow -net and the configuration, but were [%v]", options)
+	}
+}
+
+func TestSandboxEnv(t *testing.T) {
+	environ := []string{"PATH=/usr/bin", "HOME=/home/gopher", "LC_ALL=C", "AWS_SECRET_ACCESS_KEY=secret", "GITHUB_TOKEN=token", "PATHS=/x"}
+	expected(t, "SandboxEnv", strings.Join(SandboxEnv(environ), " "), "PATH=/usr/bin HOME=/home/gopher LC_ALL=C")
+}
+
+func TestCheckSandboxBuild(t *testing.T) {
+	defer func(buildFlags, toolchain string) { config.BuildFlags, config.GoToolchain = buildFlags, toolchain }(config.BuildFlags, config.GoToolchain)
+	defer func() { configSources = make(map[string]string) }()
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	script := filepath.Join(dir, "script.go")
+	if err := ioutil.WriteFile(script, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	allowed := []BuildOptions{
+		{},
+		{Flags: []string{"-trimpath", "-ldflags", "-s -w"}},
+		{Toolchain: "1.22"},
+	}
+	for _, options := range allowed {
+		if err := CheckSandboxBuild(script, options); err != nil {
+			t.Errorf("Build with %v should be allowed in the sandbox, but was refused: %s", options, err)
+		}
+	}
+	refused := []BuildOptions{
+		{Flags: []string{"-toolexec", "/tmp/evil"}},
+		{Flags: []string{"-exec=/tmp/evil"}},
+		{Flags: []string{"--compiler", "gccgo"}},
+		{Flags: []string{"-ldflags", "-linkmode=external -extld=/tmp/evil"}},
+	}
+	for _, options := range refused {
+		if err := CheckSandboxBuild(script, options); err == nil {
+			t.Errorf("Build with %v should be refused in the sandbox", options)
+		}
+	}
+
+	// The go binary of the users own configuration is trusted, unlike one chosen by the script or its project
+	config.GoToolchain = "/usr/local/go/bin/go"
+	configSources["gotoolchain"] = userGoplayRc + ":1"
+	if err := CheckSandboxBuild(script, BuildOptions{Toolchain: config.GoToolchain}); err != nil {
+		t.Errorf("GoToolchain of %s should be allowed in the sandbox, but was refused: %s", userGoplayRc, err)
+	}
+	configSources["gotoolchain"] = filepath.Join(dir, ".goplayrc") + ":1"
+	if err := CheckSandboxBuild(script, BuildOptions{Toolchain: config.GoToolchain}); err == nil {
+		t.Error("GoToolchain path of a local .goplayrc should be refused in the sandbox")
+	}
+	config.BuildFlags = "-trimpath"
+	configSources["buildflags"] = filepath.Join(dir, ".goplayrc") + ":2"
+	if err := CheckSandboxBuild(script, BuildOptions{}); err == nil {
+		t.Error("BuildFlags of a local .goplayrc should be refused in the sandbox")
+	}
+
+	evil := filepath.Join(dir, "evil.go")
+	if err := ioutil.WriteFile(evil, []byte("//goplay:go ./evil\n\npackage main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSandboxBuild(evil, BuildOptions{Toolchain: BuildOptions{}.ScriptToolchain(evil)}); err == nil {
+		t.Error("Go binary of a //goplay:go directive should be refused in the sandbox")
+	}
+}
@@ -0,0 +1,75 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsScriptMode returns true if the source has no package clause.
+// Such scripts are wrapped into a program just like snippets, top-level statements become the body of func main.
+func IsScriptMode(src []byte) bool {
+	_, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly)
+	return err != nil
+}
+
+// PrepareSource returns the path of the source file to compile for the opened script, the file may be a verified copy of the script at scriptPath.
+//
+// Scripts in script mode are wrapped into a program, with AutoImports the imports are fixed.
+// Such generated sources, as well as scripts without ".go" extension which "go build" refuses, are compiled from a copy inside binaryDir,
+// which is added to the source map of the options. The name of the copy must not start with "_" or ".", or "go build" ignores it. With -fix, fixed imports are written back into the script instead.
+func PrepareSource(file *os.File, scriptPath string, binaryDir string, options *BuildOptions) string {
+	if _, err := file.Seek(0, 0); err != nil {
+		panic(err)
+	}
+	src, err := ioutil.ReadAll(file)
+	if err != nil {
+		panic(err)
+	}
+
+	generated, offset := src, 0
+	if IsScriptMode(src) {
+		var source Source
+		generated, source = WrapSnippet(src, scriptPath)
+		offset = source.LineOffset
+	} else if config.AutoImports {
+		generated, offset = FixImports(scriptPath, src)
+		if *fixFlag && !bytes.Equal(generated, src) {
+			Verbosef("fixing imports of [%s]", scriptPath)
+			if err := file.Truncate(0); err != nil {
+				panic(err)
+			}
+			if _, err := file.WriteAt(generated, 0); err != nil {
+				panic(err)
+			}
+			src, offset = generated, 0
+		}
+	}
+	if bytes.Equal(generated, src) && strings.HasSuffix(file.Name(), ".go") {
+		return file.Name()
+	}
+
+	copyPath := filepath.Join(binaryDir, "goplay_"+strings.TrimSuffix(filepath.Base(scriptPath), ".go")+".go")
+	Verbosef("compiling [%s] from [%s]", scriptPath, copyPath)
+	if err := ioutil.WriteFile(copyPath, generated, 0600); err != nil {
+		panic(err)
+	}
+
+	source := Source{scriptPath, offset}
+	sources := SourceMap{copyPath: source, scriptPath: source} // The script itself shows up with "go build -overlay"
+	for path, original := range options.Sources {
+		sources[path] = original
+	}
+	options.Sources = sources
+	return copyPath
+}
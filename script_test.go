@@ -0,0 +1,138 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsScriptMode(t *testing.T) {
+	expected(t, "IsScriptMode", IsScriptMode([]byte("//!/usr/bin/env goplay\npackage main\n")), false)
+	expected(t, "IsScriptMode", IsScriptMode([]byte("//!/usr/bin/env goplay\nfmt.Println(\"hello\")\n")), true)
+	expected(t, "IsScriptMode", IsScriptMode([]byte("func main() {}\n")), true)
+}
+
+func prepareSource(t *testing.T, dir string, name string, src string) (string, BuildOptions) {
+	scriptPath := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(scriptPath, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.OpenFile(scriptPath, os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var options BuildOptions
+	return PrepareSource(file, scriptPath, dir, &options), options
+}
+
+func TestPrepareSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Nothing to prepare
+	sourcePath, options := prepareSource(t, dir, "plain.go", "package main\n\nfunc main() {}\n")
+	expected(t, "PrepareSource", sourcePath, filepath.Join(dir, "plain.go"))
+	expected(t, "PrepareSource", len(options.Sources), 0)
+
+	// "go build" needs the ".go" extension
+	sourcePath, options = prepareSource(t, dir, "deploy", "package main\n\nfunc main() {}\n")
+	expected(t, "PrepareSource", sourcePath, filepath.Join(dir, "goplay_deploy.go"))
+	expected(t, "PrepareSource", options.Sources[sourcePath], Source{filepath.Join(dir, "deploy"), 0})
+
+	// Script mode
+	sourcePath, options = prepareSource(t, dir, "my.tool.go", "//!/usr/bin/env goplay\nfmt.Println(\"hello\")\n")
+	expected(t, "PrepareSource", sourcePath, filepath.Join(dir, "goplay_my.tool.go"))
+	data, _ := ioutil.ReadFile(sourcePath)
+	expected(t, "PrepareSource", strings.Contains(string(data), "func main() {"), true)
+	expected(t, "PrepareSource", options.Sources[sourcePath].LineOffset, 7)
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "my.tool.go"))
+	expected(t, "PrepareSource", string(data), "//!/usr/bin/env goplay\nfmt.Println(\"hello\")\n")
+
+	// AutoImports leaves the script alone without -fix
+	config.AutoImports = true
+	defer func() { config.AutoImports = false }()
+	src := "package main\n\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n"
+	sourcePath, options = prepareSource(t, dir, "imports.go", src)
+	expected(t, "PrepareSource", sourcePath, filepath.Join(dir, "goplay_imports.go"))
+	expected(t, "PrepareSource", options.Sources[sourcePath], Source{filepath.Join(dir, "imports.go"), 2})
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "imports.go"))
+	expected(t, "PrepareSource", string(data), src)
+
+	*fixFlag = true
+	defer func() { *fixFlag = false }()
+	sourcePath, options = prepareSource(t, dir, "imports.go", src)
+	expected(t, "PrepareSource", sourcePath, filepath.Join(dir, "imports.go"))
+	data, _ = ioutil.ReadFile(filepath.Join(dir, "imports.go"))
+	expected(t, "PrepareSource", strings.Contains(string(data), "import \"fmt\""), true)
+}
+
+func TestFixFlag(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	scriptPath := filepath.Join(dir, "imports.go")
+	if err := ioutil.WriteFile(scriptPath, []byte("package main\n\nfunc main() {\n\tfmt.Print(\"fixed\")\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// -fix works without AutoImports in the configuration
+	cmd := exec.Command("goplay", "-fix", scriptPath)
+	cmd.Env = append(os.Environ(), "GOPLAY_AUTOIMPORTS=no")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	expected(t, "-fix", string(out), "fixed")
+	data, _ := ioutil.ReadFile(scriptPath)
+	expected(t, "-fix", strings.Contains(string(data), "import \"fmt\""), true)
+}
+
+func TestCompleteBuildNoExtension(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// "go build" only builds ".go" files, the copy of the script has to be added to the package
+	files := map[string]string{
+		"go.mod":    "module example.com/tool\n\ngo 1.21\n",
+		"helper.go": "package main\n\nfunc helper() string {\n\treturn \"helper\"\n}\n",
+		"tool":      "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Print(\"Hello from \", helper())\n}\n",
+		"script":    "fmt.Print(\"Hello from \", helper(), \" and \", local())\n\nfunc local() string {\n\treturn \"script mode\"\n}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out, err := exec.Command("goplay", "-b", filepath.Join(dir, "tool")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	expected(t, "-b tool", string(out), "Hello from helper")
+
+	// Script mode works as well, the other script without extension is not part of the package
+	out, err = exec.Command("goplay", "-b", filepath.Join(dir, "script")).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	expected(t, "-b script", string(out), "Hello from helper and script mode")
+}
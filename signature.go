@@ -0,0 +1,223 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Prefix of the signature embedded as last line of a script
+const SIGNATURE_DIRECTIVE = DIRECTIVE + "sig "
+
+// GoplayHome returns the directory holding the users trusted keys and signing key
+func GoplayHome() string {
+	return filepath.Join(os.Getenv("HOME"), ".goplay")
+}
+
+// TrustedKeysFile returns the file with the public keys, whose signatures are trusted
+func TrustedKeysFile() string {
+	return filepath.Join(GoplayHome(), "trusted_keys")
+}
+
+// SigningKeyFile returns the file with the private key used by "goplay sign"
+func SigningKeyFile() string {
+	return filepath.Join(GoplayHome(), "signing_key")
+}
+
+// SplitSignature returns the content of the script without its embedded signature, and the signature if there is one
+func SplitSignature(src []byte) ([]byte, string) {
+	content := bytes.TrimRight(src, "\r\n")
+	start := bytes.LastIndexByte(content, '\n') + 1
+	if line := string(content[start:]); strings.HasPrefix(line, SIGNATURE_DIRECTIVE) {
+		return src[:start], strings.TrimSpace(line[len(SIGNATURE_DIRECTIVE):])
+	}
+	return src, ""
+}
+
+// ParseTrustedKeys parses a trusted keys file, which contains one base64 encoded ed25519 public key per line, optionally followed by a comment.
+// Empty lines and lines starting with "#" are ignored.
+func ParseTrustedKeys(data []byte) (keys []ed25519.PublicKey, err error) {
+	for number, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("line %d: invalid ed25519 public key", number+1)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys, nil
+}
+
+// VerifySignature checks the signature of the file against the trusted keys, and returns the verified content of the file.
+// The signature is either embedded as last "//goplay:sig" line, or in a detached FILE.sig file.
+func VerifySignature(filename string, keys []ed25519.PublicKey) ([]byte, error) {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	content, encoded := SplitSignature(src)
+	if encoded == "" {
+		detached, err := ioutil.ReadFile(filename + ".sig")
+		if err != nil {
+			return nil, fmt.Errorf("[%s] is not signed", filename)
+		}
+		encoded = strings.TrimSpace(string(detached))
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("[%s] has an invalid signature", filename)
+	}
+	for _, key := range keys {
+		if ed25519.Verify(key, content, signature) {
+			return src, nil
+		}
+	}
+	return nil, fmt.Errorf("[%s] is not signed by a trusted key", filename)
+}
+
+// RequireSignatures exits, unless all files are signed by one of the keys in the users trusted keys file.
+// It returns the verified contents of the files, which builds have to use instead of reading the files again after the verification.
+// It does nothing and returns nil without the RequireSignature configuration.
+func RequireSignatures(files ...string) map[string][]byte {
+	if !config.RequireSignature {
+		return nil
+	}
+	verified, err := VerifySignatures(files...)
+	if err != nil {
+		log.Fatalf("Refusing to run: %s", err)
+	}
+	return verified
+}
+
+// VerifySignatures returns the verified contents of the files, or an error unless all of them are signed by one of the keys in the users trusted keys file
+func VerifySignatures(files ...string) (map[string][]byte, error) {
+	data, err := ioutil.ReadFile(TrustedKeysFile())
+	if err != nil {
+		return nil, fmt.Errorf("RequireSignature needs trusted keys: %s", err)
+	}
+	keys, err := ParseTrustedKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not read trusted keys [%s]: %s", TrustedKeysFile(), err)
+	}
+	verified := make(map[string][]byte)
+	for _, filename := range files {
+		content, err := VerifySignature(filename, keys)
+		if err != nil {
+			return nil, err
+		}
+		Verbosef("signature of [%s] verified", filename)
+		verified[filename] = content
+	}
+	return verified, nil
+}
+
+// WriteVerifiedCopies writes the verified contents of the script and its included files into binaryDir, and replaces the included files of the options with the copies.
+// It returns the path of the scripts copy and the paths of all copies, which are added to the source map of the options.
+func WriteVerifiedCopies(scriptPath string, binaryDir string, options *BuildOptions) (string, []string) {
+	sources := SourceMap{}
+	for path, original := range options.Sources {
+		sources[path] = original
+	}
+	var copies []string
+	for i, filename := range append([]string{scriptPath}, options.Includes...) {
+		copyPath := filepath.Join(binaryDir, fmt.Sprintf("goplay_signed_%d_%s.go", i, strings.TrimSuffix(filepath.Base(filename), ".go")))
+		if err := ioutil.WriteFile(copyPath, options.Verified[filename], 0600); err != nil {
+			log.Fatalf("Could not write verified copy: %s", err)
+		}
+		sources[copyPath] = Source{filename, 0}
+		copies = append(copies, copyPath)
+	}
+	options.Includes = copies[1:]
+	options.Sources = sources
+	return copies[0], copies
+}
+
+// SignScript signs the content of the script, without an already embedded signature.
+// With embed, the signature is appended as "//goplay:sig" line, otherwise it is written to FILE.sig.
+func SignScript(filename string, key ed25519.PrivateKey, embed bool) error {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	content, _ := SplitSignature(src)
+	if embed && len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(key, content))
+
+	if embed {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filename, append(content, []byte(SIGNATURE_DIRECTIVE+signature+"\n")...), info.Mode())
+	}
+	if !bytes.Equal(content, src) {
+		return fmt.Errorf("[%s] has an embedded signature, sign it with -embed again", filename)
+	}
+	return ioutil.WriteFile(filename+".sig", []byte(signature+"\n"), 0644)
+}
+
+// ReadSigningKey returns the private key in the file, which is created with a new key if it does not exist yet
+func ReadSigningKey(filename string) ed25519.PrivateKey {
+	if data, err := ioutil.ReadFile(filename); err == nil {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != ed25519.PrivateKeySize {
+			log.Fatalf("Invalid signing key [%s]", filename)
+		}
+		return ed25519.PrivateKey(key)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		log.Fatalf("Could not make directory: %s", err)
+	}
+	if err := ioutil.WriteFile(filename, []byte(base64.StdEncoding.EncodeToString(private)+"\n"), 0600); err != nil {
+		log.Fatalf("Could not write signing key: %s", err)
+	}
+	hostname, _ := os.Hostname()
+	fmt.Fprintf(os.Stderr, "Created signing key [%s], to trust its signatures add this line to %s:\n%s %s@%s\n",
+		filename, TrustedKeysFile(), base64.StdEncoding.EncodeToString(public), os.Getenv("USER"), hostname)
+	return private
+}
+
+// SignCommand implements "goplay sign [-embed] [-key FILE] FILE..."
+func SignCommand(args []string) {
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	flags.Usage = printUsage
+	embed := flags.Bool("embed", false, "embed the signature")
+	keyFile := flags.String("key", SigningKeyFile(), "signing key")
+
+	files := ParseInterspersed(flags, args)
+	if len(files) == 0 {
+		usage()
+	}
+	key := ReadSigningKey(*keyFile)
+	for _, filename := range files {
+		if err := SignScript(filename, key, *embed); err != nil {
+			log.Fatalf("Could not sign: %s", err)
+		}
+		fmt.Printf("Signed [%s]\n", filename)
+	}
+}
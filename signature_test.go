@@ -0,0 +1,242 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitSignature(t *testing.T) {
+	content, signature := SplitSignature([]byte("package main\n//goplay:sig c2ln\n"))
+	expected(t, "SplitSignature", string(content), "package main\n")
+	expected(t, "SplitSignature", signature, "c2ln")
+
+	content, signature = SplitSignature([]byte("package main\n//goplay:sig c2ln\nfunc main() {}\n"))
+	expected(t, "SplitSignature", string(content), "package main\n//goplay:sig c2ln\nfunc main() {}\n")
+	expected(t, "SplitSignature", signature, "")
+}
+
+func TestParseTrustedKeys(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseTrustedKeys([]byte("# team keys\n\n" + base64.StdEncoding.EncodeToString(public) + " alice@example\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "ParseTrustedKeys", len(keys), 1)
+	expected(t, "ParseTrustedKeys", keys[0].Equal(public), true)
+
+	if _, err := ParseTrustedKeys([]byte("c2hvcnQ= bob@example\n")); err == nil {
+		t.Error("Keys of the wrong size should be an error")
+	}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrusted, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []ed25519.PublicKey{public}
+
+	detached, embedded := filepath.Join(dir, "detached.go"), filepath.Join(dir, "embedded")
+	for _, filename := range []string{detached, embedded} {
+		if err := ioutil.WriteFile(filename, []byte("#!/usr/bin/env goplay\npackage main\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := VerifySignature(filename, keys); err == nil {
+			t.Errorf("Unsigned script [%s] should not be verified", filename)
+		}
+	}
+
+	if err := SignScript(detached, private, false); err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "SignScript", Exist(detached+".sig"), true)
+	if err := SignScript(embedded, private, true); err != nil {
+		t.Fatal(err)
+	}
+	// Signing again replaces the embedded signature
+	if err := SignScript(embedded, private, true); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile(embedded)
+	expected(t, "SignScript", strings.Count(string(data), SIGNATURE_DIRECTIVE), 1)
+	info, _ := os.Stat(embedded)
+	expected(t, "SignScript", info.Mode().Perm(), os.FileMode(0755))
+
+	for _, filename := range []string{detached, embedded} {
+		content, err := VerifySignature(filename, keys)
+		if err != nil {
+			t.Error(err)
+		}
+		data, _ := ioutil.ReadFile(filename)
+		expected(t, "VerifySignature", string(content), string(data))
+		if _, err := VerifySignature(filename, []ed25519.PublicKey{untrusted}); err == nil {
+			t.Errorf("Script [%s] should not be verified with an untrusted key", filename)
+		}
+	}
+
+	// Any change breaks the signature
+	if err := ioutil.WriteFile(detached, []byte("#!/usr/bin/env goplay\npackage main\n\nfunc init() {}\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifySignature(detached, keys); err == nil {
+		t.Error("Modified script should not be verified")
+	}
+}
+
+func TestRequireSignatureSticky(t *testing.T) {
+	var local Config
+	ParseConfiguration("goplayrc", []byte("RequireSignature yes\n"), &local)
+	ParseConfiguration(".goplayrc", []byte("RequireSignature no\n"), &local)
+	expected(t, "RequireSignature", local.RequireSignature, true)
+}
+
+func TestWriteVerifiedCopies(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The copies hold the verified contents, even if the files were changed since
+	scriptPath, include := filepath.Join(dir, "script"), filepath.Join(dir, "lib", "helper.go")
+	options := BuildOptions{
+		Includes: []string{include},
+		Verified: map[string][]byte{scriptPath: []byte("verified script"), include: []byte("verified helper")},
+	}
+	copyPath, copies := WriteVerifiedCopies(scriptPath, dir, &options)
+	expected(t, "WriteVerifiedCopies", copyPath, filepath.Join(dir, "goplay_signed_0_script.go"))
+	expected(t, "WriteVerifiedCopies", strings.Join(options.Includes, ","), filepath.Join(dir, "goplay_signed_1_helper.go"))
+	expected(t, "WriteVerifiedCopies", len(copies), 2)
+	for i, original := range []string{scriptPath, include} {
+		data, _ := ioutil.ReadFile(copies[i])
+		expected(t, "WriteVerifiedCopies", string(data), string(options.Verified[original]))
+		expected(t, "WriteVerifiedCopies", options.Sources[copies[i]], Source{original, 0})
+	}
+}
+
+func TestRequireSignatureBuilds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	home := filepath.Join(dir, "home")
+	if err := os.MkdirAll(filepath.Join(home, ".goplay"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, ".goplay", "trusted_keys"), []byte(base64.StdEncoding.EncodeToString(public)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"go.mod":     "module example.com/signed\n\ngo 1.21\n",
+		"helper.go":  "package main\n\nfunc helper() string {\n\treturn \"unsigned\"\n}\n",
+		"signed.go":  "package main\n\nfunc main() {\n\tprint(\"signed\")\n}\n",
+		"package.go": "//goplay:package .\n\npackage main\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, ".go") && name != "helper.go" {
+			if err := SignScript(filename, private, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// The build cache stays where it is, even though HOME changes
+	gocache, _ := exec.Command("go", "env", "GOCACHE").Output()
+	goplay := func(args ...string) (string, error) {
+		cmd := exec.Command("goplay", args...)
+		cmd.Env = append(os.Environ(), "HOME="+home, "GOCACHE="+strings.TrimSpace(string(gocache)), "GOPLAY_REQUIRESIGNATURE=yes")
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+	out, err := goplay(filepath.Join(dir, "signed.go"))
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	expected(t, "signed.go", out, "signed")
+
+	// Complete builds and packages would compile files without checking their signatures
+	for _, args := range [][]string{{"-b", filepath.Join(dir, "signed.go")}, {filepath.Join(dir, "package.go")}} {
+		if out, err := goplay(args...); err == nil || !strings.Contains(out, "Refusing to run") {
+			t.Errorf("goplay %s should refuse to run, but got [%s]", strings.Join(args, " "), out)
+		}
+	}
+
+	// Nothing of an unsigned script or local .goplayrc is used, like the go binary it selects
+	marker := filepath.Join(dir, "marker")
+	evil := filepath.Join(dir, "evil")
+	if err := ioutil.WriteFile(evil, []byte("#!/bin/sh\ntouch "+marker+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "toolchain.go"), []byte("//goplay:go ./evil\n\npackage main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	project := filepath.Join(dir, "project")
+	if err := os.Mkdir(project, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(project, ".goplayrc"), []byte("GoToolchain "+evil+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(project, "script.go")
+	if err := ioutil.WriteFile(script, []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := SignScript(script, private, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{{filepath.Join(dir, "toolchain.go")}, {"build", filepath.Join(dir, "toolchain.go")}, {script}} {
+		if out, err := goplay(args...); err == nil || !strings.Contains(out, "Refusing to run") {
+			t.Errorf("goplay %s should refuse to run, but got [%s]", strings.Join(args, " "), out)
+		}
+		if Exist(marker) {
+			t.Fatalf("goplay %s ran the go binary of an unsigned file", strings.Join(args, " "))
+		}
+	}
+
+	// goplay version still works, without the unsigned configuration
+	cmd := exec.Command("goplay", "version")
+	cmd.Dir = project
+	cmd.Env = append(os.Environ(), "HOME="+home, "GOPLAY_REQUIRESIGNATURE=yes")
+	if out, err := cmd.CombinedOutput(); err != nil || !strings.Contains(string(out), "skipping configuration file") || strings.Contains(string(out), evil) {
+		t.Errorf("goplay version should skip the unsigned configuration file, but got [%s] (%v)", out, err)
+	}
+	if Exist(marker) {
+		t.Fatal("goplay version ran the go binary of an unsigned file")
+	}
+}
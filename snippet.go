@@ -0,0 +1,188 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Marks the line in front of the users code inside generated sources
+const SNIPPET_MARKER = "//goplay:snippet"
+
+// SnippetDirectory returns the directory for the generated sources of snippets
+func SnippetDirectory() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	return filepath.Join(cacheDir, "goplay", "snippets")
+}
+
+// WrapSnippet turns a snippet into a complete program.
+// Snippets containing their own func main only get a package clause, all others are wrapped into func main,
+// with their top-level func and type declarations moved behind it.
+// Missing imports are added and unused ones removed, goimports-style.
+// The returned source maps the lines of the program back to the lines of the snippet, which is called name in compiler errors.
+func WrapSnippet(code []byte, name string) ([]byte, Source) {
+	importDecls, code := SplitImports(code)
+	hasMain := HasMainFunc(append([]byte("package main\n"), code...))
+	var decls []HoistedDecl
+	if !hasMain {
+		decls, code = HoistDecls(code)
+	}
+
+	wrap := func(offset int) []byte {
+		var buffer bytes.Buffer
+		if hasMain {
+			fmt.Fprintf(&buffer, "package main\n\n%s\n%s\n%s\n", importDecls, SNIPPET_MARKER, code)
+		} else {
+			fmt.Fprintf(&buffer, "package main\n\n%s\nfunc main() {\n%s\n%s\n}\n", importDecls, SNIPPET_MARKER, code)
+		}
+		// Line directives keep the line numbers of the moved declarations, the file name stays the same
+		for _, decl := range decls {
+			fmt.Fprintf(&buffer, "\n//line :%d:1\n%s\n", decl.Line+offset, decl.Code)
+		}
+		// Invalid snippets are kept as they are, to let the compiler report the problem
+		src, _ := FixImports(name+".go", buffer.Bytes())
+		return src
+	}
+	src := wrap(0)
+	offset := bytes.Count(src[:bytes.Index(src, []byte(SNIPPET_MARKER))], []byte("\n")) + 1
+	if len(decls) > 0 {
+		// The offset is only known once the imports are fixed, the line directives don't change it
+		src = wrap(offset)
+	}
+	return src, Source{name, offset}
+}
+
+// HoistedDecl is a top-level declaration moved out of func main, Line is its first line in the snippet
+type HoistedDecl struct {
+	Line int
+	Code string
+}
+
+// HoistDecls cuts the top-level func and type declarations out of the code, which can't be part of func main.
+// Only declarations starting at the beginning of a line are moved, their lines are left empty, so all other lines keep their numbers.
+func HoistDecls(code []byte) ([]HoistedDecl, []byte) {
+	fileSet := token.NewFileSet()
+	file := fileSet.AddFile("", fileSet.Base(), len(code))
+	var s scanner.Scanner
+	s.Init(file, code, nil, 0)
+
+	var decls []HoistedDecl
+	var rest bytes.Buffer
+	depth, start, last := 0, -1, 0
+	statementStart := true
+	for {
+		pos, tok, lit := s.Scan()
+		if statementStart && depth == 0 && (tok == token.FUNC || tok == token.TYPE) && file.Position(pos).Column == 1 {
+			start = file.Offset(pos)
+		}
+		switch tok {
+		case token.LPAREN, token.LBRACE, token.LBRACK:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACK:
+			depth--
+		}
+		statementStart = tok == token.SEMICOLON && depth == 0
+
+		if (statementStart || tok == token.EOF) && start >= 0 {
+			end := len(code)
+			if tok == token.SEMICOLON {
+				end = file.Offset(pos)
+				if lit == ";" {
+					end++
+				}
+			}
+			// Func literals like "func() { ... }()" are statements
+			if _, err := parser.ParseFile(token.NewFileSet(), "", "package main\n"+string(code[start:end]), 0); err == nil {
+				decls = append(decls, HoistedDecl{file.Line(file.Pos(start)), string(code[start:end])})
+				rest.Write(code[last:start])
+				rest.Write(bytes.Repeat([]byte("\n"), bytes.Count(code[start:end], []byte("\n"))))
+				last = end
+			}
+			start = -1
+		}
+		if tok == token.EOF {
+			break
+		}
+	}
+	rest.Write(code[last:])
+	return decls, rest.Bytes()
+}
+
+// SplitImports returns the leading import declarations of the code, and the code with these lines commented out.
+// Commenting them keeps the numbers of all other lines, even after the source was formatted.
+func SplitImports(code []byte) ([]byte, []byte) {
+	var importDecls []string
+	lines := strings.Split(string(code), "\n")
+	inBlock := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case inBlock:
+			inBlock = trimmed != ")"
+		case strings.HasPrefix(trimmed, "import ") || strings.HasPrefix(trimmed, "import("):
+			inBlock = strings.HasSuffix(trimmed, "(")
+		case trimmed == "" || strings.HasPrefix(trimmed, "//"):
+			continue
+		default:
+			return []byte(strings.Join(importDecls, "\n")), []byte(strings.Join(lines, "\n"))
+		}
+		importDecls = append(importDecls, line)
+		lines[i] = "//" + line
+	}
+	return []byte(strings.Join(importDecls, "\n")), []byte(strings.Join(lines, "\n"))
+}
+
+// HasMainFunc returns true if the source is a valid Go file declaring func main
+func HasMainFunc(src []byte) bool {
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return false
+	}
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteSnippet writes the wrapped snippet into the snippet directory and returns its path and source map.
+// The file is named after the hash of the snippet, so running the same snippet again reuses the cached binary.
+func WriteSnippet(code []byte, name string) (string, SourceMap) {
+	src, source := WrapSnippet(code, name)
+
+	snippetDir := SnippetDirectory()
+	if !Exist(snippetDir) {
+		if err := os.MkdirAll(snippetDir, 0700); err != nil {
+			log.Fatalf("Could not make directory: %s", err)
+		}
+	}
+	hash := sha256.Sum256(src)
+	snippetPath := filepath.Join(snippetDir, fmt.Sprintf("snippet_%x.go", hash[:8]))
+	if !Exist(snippetPath) {
+		if err := ioutil.WriteFile(snippetPath, src, 0600); err != nil {
+			log.Fatalf("Could not write snippet: %s", err)
+		}
+	}
+	Verbosef("snippet written to [%s]", snippetPath)
+
+	return snippetPath, SourceMap{snippetPath: source}
+}
@@ -0,0 +1,100 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestWrapSnippet(t *testing.T) {
+	src, source := WrapSnippet([]byte("fmt.Println(strings.ToUpper(\"a\"))"), "-e")
+	if !HasMainFunc(src) {
+		t.Fatalf("Wrapped snippet should contain func main:\n%s", src)
+	}
+	if !strings.Contains(string(src), "\"fmt\"") || !strings.Contains(string(src), "\"strings\"") {
+		t.Errorf("Wrapped snippet should import fmt and strings:\n%s", src)
+	}
+	expected(t, "WrapSnippet", source.Path, "-e")
+	lines := strings.Split(string(src), "\n")
+	expected(t, "WrapSnippet", strings.TrimSpace(lines[source.LineOffset]), "fmt.Println(strings.ToUpper(\"a\"))")
+
+	// Snippets with their own func main are not wrapped again
+	src, source = WrapSnippet([]byte("func main() {\n\tprintln(1)\n}"), "<stdin>")
+	lines = strings.Split(string(src), "\n")
+	expected(t, "WrapSnippet", lines[source.LineOffset], "func main() {")
+
+	// Leading imports are moved in front of func main, all other lines keep their numbers
+	src, source = WrapSnippet([]byte("import \"fmt\"\nimport (\n\t\"os\"\n)\n\nfmt.Println(os.Args)"), "script")
+	if !HasMainFunc(src) {
+		t.Fatalf("Wrapped snippet should contain func main:\n%s", src)
+	}
+	lines = strings.Split(string(src), "\n")
+	expected(t, "WrapSnippet", strings.TrimSpace(lines[source.LineOffset+5]), "fmt.Println(os.Args)")
+
+	// Blank lines of the snippet are kept
+	src, source = WrapSnippet([]byte("fmt.Println(1)\n\n\nundefined()"), "-e")
+	lines = strings.Split(string(src), "\n")
+	expected(t, "WrapSnippet", strings.TrimSpace(lines[source.LineOffset+3]), "undefined()")
+}
+
+func TestHoistDecls(t *testing.T) {
+	code := "x := double(1)\nfunc() {\n\tprintln(x)\n}()\n\nfunc double(i int) int {\n\treturn i * 2\n}\ntype (\n\tA int\n)\n  func indented() {}\nprintln(A(x))"
+	decls, rest := HoistDecls([]byte(code))
+	expected(t, "HoistDecls", len(decls), 2)
+	expected(t, "HoistDecls", decls[0], HoistedDecl{6, "func double(i int) int {\n\treturn i * 2\n}"})
+	expected(t, "HoistDecls", decls[1], HoistedDecl{9, "type (\n\tA int\n)"})
+	expected(t, "HoistDecls", string(rest), "x := double(1)\nfunc() {\n\tprintln(x)\n}()\n\n\n\n\n\n\n\n  func indented() {}\nprintln(A(x))")
+
+	// Moved declarations keep their line numbers
+	src, source := WrapSnippet([]byte("fmt.Println(double(1))\n\nfunc double(i int) int {\n\treturn i * 2\n}"), "-e")
+	lines := strings.Split(string(src), "\n")
+	for i, line := range lines {
+		if line == "func double(i int) int {" {
+			expected(t, "WrapSnippet", lines[i-1], fmt.Sprintf("//line :%d:1", source.LineOffset+3))
+		}
+	}
+	expected(t, "WrapSnippet", HasMainFunc(src), true)
+}
+
+func TestSplitImports(t *testing.T) {
+	importDecls, code := SplitImports([]byte("// comment\nimport \"fmt\"\nimportant := 1\nimport \"os\""))
+	expected(t, "SplitImports", string(importDecls), "import \"fmt\"")
+	expected(t, "SplitImports", string(code), "// comment\n//import \"fmt\"\nimportant := 1\nimport \"os\"")
+}
+
+func TestEvalAndStdin(t *testing.T) {
+	out, err := exec.Command("goplay", "-e", "fmt.Println(1+1, len(os.Args))", "One").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "-e", string(out), "2 2\n")
+
+	cmd := exec.Command("goplay", "-")
+	cmd.Stdin = strings.NewReader("fmt.Println(strings.Repeat(\"a\", 3))\n")
+	out, err = cmd.Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "stdin", string(out), "aaa\n")
+
+	// Compiler errors point to the snippet
+	out, _ = exec.Command("goplay", "-e", "fmt.Println(undefinedVariable)").CombinedOutput()
+	if !strings.HasPrefix(string(out), "-e:1:") {
+		t.Errorf("Compiler error should point to [-e:1], but was [%s]", out)
+	}
+	out, _ = exec.Command("goplay", "-e", "fmt.Println(1)\n\n\nfmt.Println(undefinedVariable)").CombinedOutput()
+	if !strings.HasPrefix(string(out), "-e:4:") {
+		t.Errorf("Compiler error should point to [-e:4], but was [%s]", out)
+	}
+	out, _ = exec.Command("goplay", "-e", "fmt.Println(f())\n\nfunc f() int {\n\treturn undefinedVariable\n}").CombinedOutput()
+	if !strings.HasPrefix(string(out), "-e:4:") {
+		t.Errorf("Compiler error should point to [-e:4], but was [%s]", out)
+	}
+}
@@ -0,0 +1,16 @@
+#!/usr/bin/env goplay
+
+//goplay:build -race
+//goplay:build   -tags=integration
+//goplay:builder ignored
+
+package main
+
+import (
+	"fmt"
+)
+
+// //goplay:build ignored, directives have to start at the beginning of a line
+func main() {
+	fmt.Println("Directives!")
+}
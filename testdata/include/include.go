@@ -0,0 +1,11 @@
+#!/usr/bin/env goplay
+
+//goplay:include lib/*.go
+
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Print(Greeting("include"))
+}
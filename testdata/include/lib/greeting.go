@@ -0,0 +1,5 @@
+package main
+
+func Greeting(name string) string {
+	return "Hello from " + name
+}
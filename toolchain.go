@@ -0,0 +1,86 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var minorVersionRx = regexp.MustCompile(`^go1\.\d+$`)
+
+// ScriptToolchain returns the Go toolchain requested for the script, from its //goplay:go directive or the GoToolchain configuration.
+// Relative paths of go binaries in directives are relative to the scripts directory.
+func (o BuildOptions) ScriptToolchain(scriptPath string) string {
+	if versions := o.Directives(scriptPath, "go"); len(versions) > 0 {
+		toolchain := versions[len(versions)-1]
+		if IsToolchainPath(toolchain) && !filepath.IsAbs(toolchain) {
+			toolchain = filepath.Join(filepath.Dir(scriptPath), toolchain)
+		}
+		return toolchain
+	}
+	return config.GoToolchain
+}
+
+// IsToolchainPath returns true if the toolchain is given as path of a go binary, instead of a version
+func IsToolchainPath(toolchain string) bool {
+	return strings.ContainsAny(toolchain, `/\`)
+}
+
+// ToolchainName returns the toolchain version in the form used by the go command, "1.22" becomes "go1.22"
+func ToolchainName(toolchain string) string {
+	return "go" + strings.TrimPrefix(toolchain, "go")
+}
+
+// FindToolchain returns the go binary for the toolchain, which is either the path of a go binary or a version.
+// Paths are made absolute, as builds run in other directories.
+// Versions are looked up as $HOME/sdk/goX/bin/go and as goX command on the PATH, like installed by golang.org/dl.
+// If neither exists, "" is returned and the go command on the PATH switches to the toolchain via GOTOOLCHAIN.
+func FindToolchain(toolchain string) string {
+	if toolchain == "" {
+		return ""
+	}
+	if IsToolchainPath(toolchain) {
+		path, err := filepath.Abs(toolchain)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !Exist(path) {
+			log.Fatalf("Go toolchain [%s] does not exist", path)
+		}
+		return path
+	}
+
+	name := ToolchainName(toolchain)
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		if sdk := filepath.Join(home, "sdk", name, "bin", "go"+exe); Exist(sdk) {
+			return sdk
+		}
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+	return ""
+}
+
+// GoToolchainEnv returns the value of GOTOOLCHAIN selecting the toolchain, minor versions like "go1.22" select their first release "go1.22.0"
+func GoToolchainEnv(toolchain string) string {
+	name := ToolchainName(toolchain)
+	if minorVersionRx.MatchString(name) {
+		name += ".0"
+	}
+	return name
+}
@@ -0,0 +1,73 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestToolchainName(t *testing.T) {
+	expected(t, "ToolchainName", ToolchainName("1.22"), "go1.22")
+	expected(t, "ToolchainName", ToolchainName("go1.22.3"), "go1.22.3")
+	expected(t, "GoToolchainEnv", GoToolchainEnv("1.22"), "go1.22.0")
+	expected(t, "GoToolchainEnv", GoToolchainEnv("1.22.3"), "go1.22.3")
+	expected(t, "IsToolchainPath", IsToolchainPath("/usr/lib/go-1.22/bin/go"), true)
+	expected(t, "IsToolchainPath", IsToolchainPath("1.22"), false)
+}
+
+func TestFindToolchain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	home := os.Getenv("HOME")
+	defer os.Setenv("HOME", home)
+	os.Setenv("HOME", dir)
+
+	exe := ""
+	if runtime.GOOS == "windows" {
+		exe = ".exe"
+	}
+	sdk := filepath.Join(dir, "sdk", "go1.99", "bin", "go"+exe)
+	if err := os.MkdirAll(filepath.Dir(sdk), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(sdk, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	expected(t, "FindToolchain", FindToolchain(""), "")
+	expected(t, "FindToolchain", FindToolchain("1.99"), sdk)
+	expected(t, "FindToolchain", FindToolchain(sdk), sdk)
+
+	// Relative paths are made absolute
+	wd, _ := os.Getwd()
+	if rel, err := filepath.Rel(wd, sdk); err == nil {
+		expected(t, "FindToolchain", FindToolchain(rel), sdk)
+	}
+
+	// Relative paths in directives belong to the scripts directory
+	scriptPath := filepath.Join(dir, "script.go")
+	if err := ioutil.WriteFile(scriptPath, []byte("//goplay:go ./sdk/go1.99/bin/go\n\npackage main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "ScriptToolchain", BuildOptions{}.ScriptToolchain(scriptPath), filepath.Join(dir, "sdk", "go1.99", "bin", "go"))
+
+	// Unknown versions are left to GOTOOLCHAIN
+	expected(t, "FindToolchain", FindToolchain("1.98"), "")
+	options := BuildOptions{Toolchain: "1.98"}
+	expected(t, "Go", options.Go(), "go")
+	if !strings.Contains(strings.Join(options.Env(), "\n"), "\nGOTOOLCHAIN=go1.98.0") {
+		t.Error("Unknown toolchains should be selected with GOTOOLCHAIN")
+	}
+}
@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// The file watcher used for hot reload
+const WATCHER_BACKEND = "github.com/howeyc/fsnotify"
+
+// Version returns the version of goplay itself, as recorded by the go command in the binary
+func Version() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// WatcherVersion returns the version of the file watcher dependency, if known
+func WatcherVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == WATCHER_BACKEND {
+				return dep.Version
+			}
+		}
+	}
+	return "(unknown)"
+}
+
+// ToolchainVersion returns the version of the go command that scripts are compiled with, using the toolchain of the options
+func ToolchainVersion(options BuildOptions) string {
+	cmd := exec.Command(options.Go(), "version")
+	cmd.Env = options.Env()
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Sprintf("(unknown: %s)", err)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(string(out), "go version "))
+}
+
+// GoCommandPath returns the path of the go command of the options, as found on the PATH
+func GoCommandPath(options BuildOptions) string {
+	path, err := exec.LookPath(options.Go())
+	if err != nil {
+		return fmt.Sprintf("(not found: %s)", options.Go())
+	}
+	return path
+}
+
+// VersionCommand implements "goplay version" and "goplay --version"
+func VersionCommand() {
+	cacheDir := config.GoplayDirectory
+	if wd, err := os.Getwd(); err == nil {
+		// Version information is also needed where scripts are refused
+		ReadConfigurationSkipUnsigned(wd)
+		// The cache root of the scripts in the current directory
+		cacheDir = CacheRoot(filepath.Join(wd, "script.go"))
+	}
+	options := BuildOptions{Toolchain: config.GoToolchain}
+	options.GoCommand = FindToolchain(options.Toolchain)
+	PrintVersion(os.Stdout, cacheDir, options)
+}
+
+// PrintVersion prints everything a bug report needs to know about goplay and its environment,
+// including the toolchain of the options that scripts are compiled with
+func PrintVersion(writer io.Writer, cacheDir string, options BuildOptions) {
+	fmt.Fprintf(writer, "goplay %s\n", Version())
+	fmt.Fprintf(writer, "built with:    %s\n", runtime.Version())
+	fmt.Fprintf(writer, "toolchain:     %s\n", ToolchainVersion(options))
+	fmt.Fprintf(writer, "go command:    %s\n", GoCommandPath(options))
+	if options.Toolchain != "" {
+		fmt.Fprintf(writer, "GoToolchain:   %s\n", options.Toolchain)
+	}
+	fmt.Fprintf(writer, "GOOS/GOARCH:   %s/%s\n", options.OS(), options.Arch())
+	fmt.Fprintf(writer, "cache:         %s\n", cacheDir)
+	fmt.Fprintf(writer, "watcher:       %s %s\n", WATCHER_BACKEND, WatcherVersion())
+}
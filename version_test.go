@@ -0,0 +1,76 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this file,
+// You can obtain one at http://mozilla.org/MPL/2.0/.
+//
+// Copyright (c) 2013 JamesClonk
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPrintVersion(t *testing.T) {
+	var buffer bytes.Buffer
+	PrintVersion(&buffer, "/tmp/.goplay_bin", BuildOptions{})
+	out := buffer.String()
+
+	goVersion, err := exec.Command("go", "env", "GOVERSION").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"goplay " + Version() + "\n",
+		"toolchain:     " + strings.TrimSpace(string(goVersion)) + " ",
+		"GOOS/GOARCH:   " + runtime.GOOS + "/" + runtime.GOARCH + "\n",
+		"cache:         /tmp/.goplay_bin\n",
+		"watcher:       " + WATCHER_BACKEND,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("Version information should contain [%s], but was:\n%s", line, out)
+		}
+	}
+}
+
+func TestToolchainVersion(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no shell scripts on windows")
+	}
+	// The version comes from the toolchain scripts are compiled with, not from the go command on the PATH
+	dir, err := ioutil.TempDir("", "goplay_version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	goCommand := filepath.Join(dir, "go")
+	if err := ioutil.WriteFile(goCommand, []byte("#!/bin/sh\necho go version go1.99.1 plan9/mips\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	expected(t, "ToolchainVersion", ToolchainVersion(BuildOptions{Toolchain: goCommand, GoCommand: goCommand}), "go1.99.1 plan9/mips")
+}
+
+func TestVersionCommandCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goplay_version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Shared goplay directories show the users own directory, not the one of some script
+	cmd := exec.Command("goplay", "version")
+	cmd.Env = append(os.Environ(), "GOPLAY_GOPLAYDIRECTORY="+dir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	if line := "cache:         " + filepath.Join(dir, UserDirectoryName()) + "\n"; !strings.Contains(string(out), line) {
+		t.Errorf("goplay version should contain [%s], but was:\n%s", line, out)
+	}
+}